@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/trly/quad-ops/internal/systemd"
+)
+
+// DaemonCmd runs the sync reconciler continuously, keeping a systemd
+// connection open between runs and reconnecting if it is lost. SIGHUP
+// reloads the config file. SIGTERM/SIGINT cancel the root context, which
+// aborts the git fetches of an in-progress run and then shuts the daemon
+// down; a second signal terminates it immediately.
+type DaemonCmd struct {
+	Interval    time.Duration `help:"time between sync runs" default:"5m"`
+	Jitter      time.Duration `help:"maximum random delay added to each interval" default:"30s"`
+	WebhookAddr string        `help:"listen address for the push webhook receiver (e.g. :9000); disabled if empty"`
+
+	webhook *webhookHandler
+	// connect opens a systemd connection; systemd.New unless overridden
+	// by tests.
+	connect func(context.Context, systemd.Scope) (systemd.Client, error)
+}
+
+// Run executes the daemon command.
+func (d *DaemonCmd) Run(globals *Globals) error {
+	if globals.AppCfg == nil {
+		return fmt.Errorf("configuration not loaded")
+	}
+	if d.Interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", d.Interval)
+	}
+
+	ctx := globals.Context()
+
+	if d.connect == nil {
+		d.connect = systemd.New
+	}
+	client, err := d.connect(ctx, systemd.ScopeAuto)
+	if err != nil {
+		return fmt.Errorf("failed to connect to systemd: %w", err)
+	}
+
+	// SIGINT and SIGTERM are left to the root context so that a second
+	// one still terminates the daemon immediately.
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	trigger := newSyncTrigger()
+	if d.WebhookAddr != "" {
+		stop, err := d.serveWebhook(globals, trigger)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	// Wait for the state lock so a manual sync delays, rather than drops, a
+	// scheduled or webhook-triggered run.
+	syncCmd := &SyncCmd{client: client, Wait: true}
+	defer func() { _ = syncCmd.client.Close() }()
+	return d.loop(ctx, globals, hangups, trigger, func(ctx context.Context, globals *Globals, repoNames []string) error {
+		if err := d.reconnect(ctx, syncCmd); err != nil {
+			return err
+		}
+		return syncCmd.run(ctx, globals, repoNames)
+	})
+}
+
+// reconnect replaces the systemd connection of s if it was lost, for
+// example because dbus or systemd restarted. If connecting fails, the next
+// run tries again.
+func (d *DaemonCmd) reconnect(ctx context.Context, s *SyncCmd) error {
+	if s.client.Connected() {
+		return nil
+	}
+	slog.Warn("systemd connection lost, reconnecting")
+	client, err := d.connect(ctx, systemd.ScopeAuto)
+	if err != nil {
+		return fmt.Errorf("failed to reconnect to systemd: %w", err)
+	}
+	_ = s.client.Close()
+	s.client = client
+	return nil
+}
+
+// serveWebhook starts the push webhook receiver on WebhookAddr and returns
+// a function that shuts it down.
+func (d *DaemonCmd) serveWebhook(globals *Globals, trigger *syncTrigger) (func(), error) {
+	secret, err := globals.AppCfg.Webhook.GetSecret()
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("webhook receiver requires webhook.secret or webhook.secretFile in the configuration")
+	}
+
+	ln, err := net.Listen("tcp", d.WebhookAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for webhooks: %w", err)
+	}
+
+	d.webhook = newWebhookHandler(globals.AppCfg, trigger)
+	mux := http.NewServeMux()
+	mux.Handle("/webhook", d.webhook)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("webhook receiver stopped", "error", err)
+		}
+	}()
+	slog.Info("listening for webhooks", "addr", ln.Addr().String(), "path", "/webhook")
+
+	return func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}, nil
+}
+
+// loop invokes run for all repositories immediately and then after every
+// interval until ctx is cancelled. Repositories queued on the trigger are
+// synced as soon as the loop is idle. A value on hangups reloads the
+// configuration once any in-progress run returns. Cancelling ctx aborts a
+// run's git fetches, but units already written are still applied.
+func (d *DaemonCmd) loop(ctx context.Context, globals *Globals, hangups <-chan os.Signal, trigger *syncTrigger, run func(context.Context, *Globals, []string) error) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("shutting down", "reason", context.Cause(ctx).Error())
+			return nil
+
+		case <-hangups:
+			d.reload(globals)
+
+		case <-trigger.notify:
+			names := trigger.take()
+			if len(names) == 0 {
+				continue
+			}
+			if err := run(ctx, globals, names); err != nil {
+				slog.Error("sync failed", "repos", names, "error", err)
+			}
+
+		case <-timer.C:
+			if err := run(ctx, globals, nil); err != nil {
+				slog.Error("sync failed", "error", err)
+			}
+			next := d.nextDelay()
+			slog.Info("scheduled next sync", "in", next.Round(time.Second).String())
+			timer.Reset(next)
+		}
+	}
+}
+
+// reload re-reads the config file, keeping the current configuration if
+// the new one cannot be loaded.
+func (d *DaemonCmd) reload(globals *Globals) {
+	cfg, err := loadConfig(globals.ConfigPath)
+	if err != nil {
+		slog.Warn("failed to reload configuration, keeping previous", "path", globals.ConfigPath, "error", err)
+		return
+	}
+	globals.AppCfg = cfg
+	if d.webhook != nil {
+		d.webhook.cfg.Store(cfg)
+	}
+	slog.Info("reloaded configuration", "path", globals.ConfigPath)
+}
+
+// nextDelay returns the interval plus a random jitter in [0, Jitter).
+func (d *DaemonCmd) nextDelay() time.Duration {
+	if d.Jitter <= 0 {
+		return d.Interval
+	}
+	return d.Interval + rand.N(d.Jitter)
+}
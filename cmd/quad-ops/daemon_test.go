@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trly/quad-ops/internal/config"
+	"github.com/trly/quad-ops/internal/systemd"
+)
+
+// TestDaemonNextDelayWithinJitter tests that jitter is bounded.
+func TestDaemonNextDelayWithinJitter(t *testing.T) {
+	d := &DaemonCmd{Interval: time.Minute, Jitter: 10 * time.Second}
+	for range 100 {
+		delay := d.nextDelay()
+		assert.GreaterOrEqual(t, delay, time.Minute)
+		assert.Less(t, delay, time.Minute+10*time.Second)
+	}
+}
+
+// TestDaemonNextDelayNoJitter tests that a zero jitter yields the exact interval.
+func TestDaemonNextDelayNoJitter(t *testing.T) {
+	d := &DaemonCmd{Interval: time.Minute}
+	assert.Equal(t, time.Minute, d.nextDelay())
+}
+
+// TestDaemonLoopStopsOnCancel tests that the loop runs immediately and
+// that cancelling the root context, as SIGINT or SIGTERM do, stops it.
+func TestDaemonLoopStopsOnCancel(t *testing.T) {
+	d := &DaemonCmd{Interval: time.Hour}
+	globals := &Globals{AppCfg: &config.AppConfig{}}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runs := 0
+	run := func(context.Context, *Globals, []string) error {
+		runs++
+		cancel()
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- d.loop(ctx, globals, make(chan os.Signal), newSyncTrigger(), run) }()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon loop did not stop after cancellation")
+	}
+	assert.Equal(t, 1, runs)
+}
+
+// TestDaemonLoopRunsTriggeredRepos tests that repositories queued by a
+// webhook are synced on their own.
+func TestDaemonLoopRunsTriggeredRepos(t *testing.T) {
+	d := &DaemonCmd{Interval: time.Hour}
+	globals := &Globals{AppCfg: &config.AppConfig{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	trigger := newSyncTrigger()
+
+	var calls [][]string
+	run := func(_ context.Context, _ *Globals, names []string) error {
+		calls = append(calls, names)
+		if names == nil {
+			trigger.add("infra", "apps")
+			return nil
+		}
+		cancel()
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- d.loop(ctx, globals, make(chan os.Signal), trigger, run) }()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon loop did not stop after cancellation")
+	}
+	require.Len(t, calls, 2)
+	assert.Nil(t, calls[0], "first run should sync all repositories")
+	assert.Equal(t, []string{"apps", "infra"}, calls[1])
+}
+
+// TestDaemonReloadOnSIGHUP tests that SIGHUP replaces the loaded configuration.
+func TestDaemonReloadOnSIGHUP(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("quadletDir: /reloaded\n"), 0o644))
+
+	d := &DaemonCmd{}
+	globals := &Globals{AppCfg: &config.AppConfig{QuadletDir: "/original"}, ConfigPath: configPath}
+
+	d.reload(globals)
+	assert.Equal(t, "/reloaded", globals.AppCfg.QuadletDir)
+}
+
+// TestDaemonReloadKeepsConfigOnError tests that an invalid config file is ignored.
+func TestDaemonReloadKeepsConfigOnError(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("repositories: ["), 0o644))
+
+	d := &DaemonCmd{}
+	globals := &Globals{AppCfg: &config.AppConfig{QuadletDir: "/original"}, ConfigPath: configPath}
+
+	d.reload(globals)
+	assert.Equal(t, "/original", globals.AppCfg.QuadletDir)
+}
+
+// disconnectedClient is a systemd.Client whose connection was lost.
+type disconnectedClient struct{ noopClient }
+
+func (disconnectedClient) Connected() bool { return false }
+
+// TestDaemonReconnectsLostConnection tests that a run replaces a systemd
+// connection that was lost, and keeps a live one.
+func TestDaemonReconnectsLostConnection(t *testing.T) {
+	connects := 0
+	d := &DaemonCmd{connect: func(context.Context, systemd.Scope) (systemd.Client, error) {
+		connects++
+		return noopClient{}, nil
+	}}
+
+	s := &SyncCmd{client: disconnectedClient{}}
+	require.NoError(t, d.reconnect(context.Background(), s))
+	assert.Equal(t, noopClient{}, s.client)
+	assert.Equal(t, 1, connects)
+
+	require.NoError(t, d.reconnect(context.Background(), s))
+	assert.Equal(t, 1, connects, "a live connection should be kept")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/trly/quad-ops/internal/state"
+	"github.com/trly/quad-ops/internal/systemd"
+)
+
+// GCCmd finds units in the quadlet directory that quad-ops generated but no
+// longer records in state, for example after the state file was lost, and
+// adopts or removes them.
+type GCCmd struct {
+	Adopt  bool `help:"record orphaned units in state under the repository named in their labels" xor:"action"`
+	Remove bool `help:"stop and remove orphaned units" xor:"action"`
+	Wait   bool `help:"wait for a concurrent sync to finish instead of failing immediately" default:"false"`
+
+	// client overrides the systemd connection, for tests and callers that
+	// hold one already.
+	client systemd.Client
+}
+
+// Run executes the gc command.
+func (c *GCCmd) Run(globals *Globals) error {
+	if globals.AppCfg == nil {
+		return fmt.Errorf("configuration not loaded")
+	}
+
+	ctx := globals.Context()
+	lock, err := lockState(ctx, globals, c.Wait)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	stateFilePath := globals.AppCfg.GetStateFilePath()
+	deployState, err := state.Load(stateFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	orphans, err := findOrphans(deployState, globals.AppCfg.GetQuadletDir())
+	if err != nil {
+		return err
+	}
+	if err := renderOrphans(os.Stdout, orphans); err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	switch {
+	case c.Adopt:
+		adopted := adoptUnits(deployState, orphans)
+		if err := deployState.Save(stateFilePath); err != nil {
+			return fmt.Errorf("failed to save state: %w", err)
+		}
+		fmt.Printf("Adopted %d of %d units; the next sync removes those their repository no longer defines\n", adopted, len(orphans))
+	case c.Remove:
+		if err := c.remove(ctx, globals, deployState, orphans); err != nil {
+			return err
+		}
+		if err := deployState.Save(stateFilePath); err != nil {
+			return fmt.Errorf("failed to save state: %w", err)
+		}
+	default:
+		fmt.Println("Run with --adopt to record these units in state, or --remove to stop and remove them")
+	}
+	return nil
+}
+
+// remove stops and deletes the orphaned units, then reloads systemd so the
+// generated services disappear.
+func (c *GCCmd) remove(ctx context.Context, globals *Globals, deployState *state.State, orphans []systemd.LabeledUnit) error {
+	client := c.client
+	if client == nil {
+		var err error
+		client, err = systemd.New(ctx, systemd.ScopeAuto)
+		if err != nil {
+			return fmt.Errorf("failed to connect to systemd: %w", err)
+		}
+		defer func() { _ = client.Close() }()
+	}
+
+	names := make([]string, 0, len(orphans))
+	for _, u := range orphans {
+		names = append(names, u.Name)
+	}
+
+	removed := (&SyncCmd{}).cleanupStaleUnits(ctx, globals, deployState, client, names, nil, nil)
+	if err := client.DaemonReload(ctx); err != nil {
+		return fmt.Errorf("failed to reload systemd: %w", err)
+	}
+	fmt.Printf("Removed %d of %d units\n", len(removed), len(orphans))
+	return nil
+}
+
+// findOrphans returns the labeled units in quadletDir that no repository
+// in state manages.
+func findOrphans(deployState *state.State, quadletDir string) ([]systemd.LabeledUnit, error) {
+	labeled, err := systemd.FindLabeledUnits(quadletDir)
+	if err != nil {
+		return nil, err
+	}
+	managed := deployState.CollectAllManagedUnits()
+	return slices.DeleteFunc(labeled, func(u systemd.LabeledUnit) bool {
+		_, ok := managed[u.Name]
+		return ok
+	}), nil
+}
+
+// adoptUnits records each orphan as managed by the repository named in its
+// labels and returns how many were adopted. Units without a repository
+// label are skipped.
+func adoptUnits(deployState *state.State, orphans []systemd.LabeledUnit) int {
+	var adopted int
+	for _, u := range orphans {
+		if u.Repository == "" {
+			slog.Warn("unit has no repository label, not adopting", "unit", u.Name)
+			continue
+		}
+		deployState.RetainUnits(u.Repository, u.Name)
+		adopted++
+	}
+	return adopted
+}
+
+// renderOrphans lists the orphaned units and the repository each belongs to.
+func renderOrphans(w io.Writer, orphans []systemd.LabeledUnit) error {
+	if len(orphans) == 0 {
+		_, err := fmt.Fprintln(w, "No orphaned units")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "UNIT\tREPOSITORY")
+	for _, u := range orphans {
+		repo := u.Repository
+		if repo == "" {
+			repo = "-"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", u.Name, repo)
+	}
+	return tw.Flush()
+}
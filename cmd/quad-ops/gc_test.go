@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trly/quad-ops/internal/config"
+	"github.com/trly/quad-ops/internal/systemd"
+)
+
+func writeLabeledUnit(t *testing.T, dir, name, repo string) {
+	t.Helper()
+	content := "[Container]\nImage=nginx\nLabel=com.github.trly.quad-ops.repository.name=" + repo + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+// TestFindOrphansSkipsManagedUnits tests that only labeled units missing
+// from state are reported.
+func TestFindOrphansSkipsManagedUnits(t *testing.T) {
+	dir := t.TempDir()
+	writeLabeledUnit(t, dir, "app-web.container", "infra")
+	writeLabeledUnit(t, dir, "app-old.container", "infra")
+	writeLabeledUnit(t, dir, "lost-api.container", "lost")
+
+	orphans, err := findOrphans(testStatusState(), dir)
+	require.NoError(t, err)
+	assert.Equal(t, []systemd.LabeledUnit{
+		{Name: "app-old.container", Repository: "infra"},
+		{Name: "lost-api.container", Repository: "lost"},
+	}, orphans)
+}
+
+// TestAdoptUnits tests that orphans are added to their labeled repository.
+func TestAdoptUnits(t *testing.T) {
+	s := testStatusState()
+	adopted := adoptUnits(s, []systemd.LabeledUnit{
+		{Name: "app-old.container", Repository: "infra"},
+		{Name: "lost-api.container", Repository: "lost"},
+		{Name: "nameless.network"},
+	})
+
+	assert.Equal(t, 2, adopted)
+	assert.Equal(t, []string{"app-web.container", "app-data.volume", "app-old.container"}, s.GetManagedUnits("infra"))
+	assert.Equal(t, []string{"lost-api.container"}, s.GetManagedUnits("lost"))
+}
+
+// TestGCRemoveDeletesOrphans tests that removed orphans disappear from the
+// quadlet directory.
+func TestGCRemoveDeletesOrphans(t *testing.T) {
+	dir := t.TempDir()
+	writeLabeledUnit(t, dir, "lost-api.container", "lost")
+
+	globals := &Globals{AppCfg: &config.AppConfig{QuadletDir: dir}}
+	gc := &GCCmd{Remove: true, client: noopClient{}}
+	orphans := []systemd.LabeledUnit{{Name: "lost-api.container", Repository: "lost"}}
+
+	require.NoError(t, gc.remove(context.Background(), globals, testStatusState(), orphans))
+	_, err := os.Stat(filepath.Join(dir, "lost-api.container"))
+	assert.True(t, os.IsNotExist(err))
+}
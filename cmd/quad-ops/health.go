@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/trly/quad-ops/internal/podman"
+	"github.com/trly/quad-ops/internal/state"
+	"github.com/trly/quad-ops/internal/systemd"
+)
+
+// healthPollInterval is how often deployed services are checked during the
+// auto-rollback window.
+const healthPollInterval = 5 * time.Second
+
+// unhealthyFunc lists the systemd units whose containers fail their health
+// check.
+type unhealthyFunc func(context.Context) ([]string, error)
+
+// watchHealth polls the services deployed for each repository until window
+// elapses and returns the services that became unhealthy, keyed by
+// repository. A service is unhealthy if systemd reports it failed or
+// waiting to be restarted after a crash, or if podman reports its
+// container's health check failing. Polling stops early once every
+// repository has an unhealthy service.
+func watchHealth(ctx context.Context, client systemd.Client, deployed map[string][]string, window, interval time.Duration, unhealthy unhealthyFunc) map[string][]string {
+	owners := make(map[string]string)
+	for repo, services := range deployed {
+		for _, svc := range services {
+			owners[svc] = repo
+		}
+	}
+	services := slices.Sorted(maps.Keys(owners))
+
+	bad := make(map[string][]string)
+	mark := func(svc string) {
+		repo := owners[svc]
+		if !slices.Contains(bad[repo], svc) {
+			bad[repo] = append(bad[repo], svc)
+		}
+	}
+
+	check := func() {
+		statuses, err := client.Status(ctx, services...)
+		if err != nil {
+			slog.Warn("failed to query service status", "error", err)
+		}
+		for _, st := range statuses {
+			if st.ActiveState == "failed" || st.SubState == "auto-restart" {
+				mark(st.Name)
+			}
+		}
+
+		names, err := unhealthy(ctx)
+		if err != nil {
+			slog.Warn("failed to query container health", "error", err)
+		}
+		for _, name := range names {
+			if _, ok := owners[name]; ok {
+				mark(name)
+			}
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(window)
+	defer deadline.Stop()
+
+	for len(bad) < len(deployed) {
+		select {
+		case <-ctx.Done():
+			return bad
+		case <-ticker.C:
+			check()
+		case <-deadline.C:
+			check()
+			return bad
+		}
+	}
+	return bad
+}
+
+// verifyDeploys watches the services of repositories that deployed a new
+// generation and rolls back those whose services become unhealthy. The
+// failed generations are marked so later syncs do not redeploy them.
+func (s *SyncCmd) verifyDeploys(ctx context.Context, globals *Globals, sr *syncResult) error {
+	window := globals.AppCfg.AutoRollback.GetWindow()
+	slog.Info("watching deployed services", "repos", slices.Sorted(maps.Keys(sr.deployed)), "window", window.String())
+
+	client := s.client
+	if client == nil {
+		var err error
+		client, err = systemd.New(ctx, systemd.ScopeAuto)
+		if err != nil {
+			return fmt.Errorf("failed to connect to systemd: %w", err)
+		}
+		defer func() { _ = client.Close() }()
+	}
+
+	bad := watchHealth(ctx, client, sr.deployed, window, healthPollInterval, podman.UnhealthyServices)
+	if ctx.Err() != nil {
+		return fmt.Errorf("health check interrupted, deployed services were not verified: %w", ctx.Err())
+	}
+	if len(bad) == 0 {
+		slog.Info("deployed services are healthy")
+		return nil
+	}
+
+	stateFilePath := globals.AppCfg.GetStateFilePath()
+	deployState, err := state.Load(stateFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	repos := slices.Sorted(maps.Keys(bad))
+	failedCommits := make(map[string]string, len(repos))
+	for _, repo := range repos {
+		slog.Error("services unhealthy after deploy, rolling back", "repo", repo, "services", bad[repo])
+		sr.report.repo(repo).UnhealthyServices = bad[repo]
+		failedCommits[repo] = deployState.GetCurrent(repo)
+		deployState.MarkGenerationFailed(repo, deployState.GetRepo(repo).Active)
+	}
+	if err := deployState.Save(stateFilePath); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+
+	rollback := &SyncCmd{Rollback: true, client: client}
+	rollbackErr := rollback.reconcile(ctx, globals, repos)
+
+	if deployState, err := state.Load(stateFilePath); err == nil {
+		for _, repo := range repos {
+			if current := deployState.GetCurrent(repo); current != failedCommits[repo] {
+				sr.report.repo(repo).RolledBackTo = current
+			}
+		}
+	}
+
+	return errors.Join(
+		fmt.Errorf("services unhealthy after deploying %s; rolled back", strings.Join(repos, ", ")),
+		rollbackErr,
+	)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/trly/quad-ops/internal/systemd"
+)
+
+func noUnhealthy(context.Context) ([]string, error) { return nil, nil }
+
+func TestWatchHealthDetectsFailedServices(t *testing.T) {
+	client := statusClient{statuses: []systemd.UnitStatus{
+		{Name: "web-app.service", ActiveState: "failed", SubState: "failed"},
+		{Name: "web-worker.service", ActiveState: "active", SubState: "running"},
+		{Name: "api-server.service", ActiveState: "activating", SubState: "auto-restart"},
+		{Name: "db-main.service", ActiveState: "active", SubState: "running"},
+	}}
+	deployed := map[string][]string{
+		"web": {"web-app.service", "web-worker.service"},
+		"api": {"api-server.service"},
+		"db":  {"db-main.service"},
+	}
+
+	bad := watchHealth(context.Background(), client, deployed, 50*time.Millisecond, 10*time.Millisecond, noUnhealthy)
+	assert.Equal(t, map[string][]string{
+		"web": {"web-app.service"},
+		"api": {"api-server.service"},
+	}, bad)
+}
+
+func TestWatchHealthUsesPodmanHealth(t *testing.T) {
+	client := statusClient{statuses: []systemd.UnitStatus{
+		{Name: "web-app.service", ActiveState: "active", SubState: "running"},
+	}}
+	deployed := map[string][]string{"web": {"web-app.service"}}
+	unhealthy := func(context.Context) ([]string, error) {
+		return []string{"web-app.service", "unrelated.service"}, nil
+	}
+
+	start := time.Now()
+	bad := watchHealth(context.Background(), client, deployed, time.Minute, 10*time.Millisecond, unhealthy)
+	assert.Equal(t, map[string][]string{"web": {"web-app.service"}}, bad)
+	assert.Less(t, time.Since(start), time.Minute, "should stop once every repository is unhealthy")
+}
+
+func TestWatchHealthHealthy(t *testing.T) {
+	client := statusClient{statuses: []systemd.UnitStatus{
+		{Name: "web-app.service", ActiveState: "active", SubState: "running"},
+	}}
+	deployed := map[string][]string{"web": {"web-app.service"}}
+
+	bad := watchHealth(context.Background(), client, deployed, 30*time.Millisecond, 10*time.Millisecond, noUnhealthy)
+	assert.Empty(t, bad)
+}
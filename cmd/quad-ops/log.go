@@ -0,0 +1,25 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+)
+
+// newLogger builds the process logger. By default only warnings and errors
+// are logged; --verbose adds progress messages and --debug adds detailed
+// diagnostics annotated with their source location.
+func newLogger(w io.Writer, format string, verbose, debug bool) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: slog.LevelWarn}
+	switch {
+	case debug:
+		opts.Level = slog.LevelDebug
+		opts.AddSource = true
+	case verbose:
+		opts.Level = slog.LevelInfo
+	}
+
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLoggerLevels(t *testing.T) {
+	tests := []struct {
+		name    string
+		verbose bool
+		debug   bool
+		want    []string
+	}{
+		{"default", false, false, []string{"warn"}},
+		{"verbose", true, false, []string{"info", "warn"}},
+		{"debug", false, true, []string{"debug", "info", "warn"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := newLogger(&buf, "text", tt.verbose, tt.debug)
+			logger.Debug("debug")
+			logger.Info("info")
+			logger.Warn("warn")
+
+			var got []string
+			for line := range strings.Lines(buf.String()) {
+				for _, msg := range []string{"debug", "info", "warn"} {
+					if strings.Contains(line, "msg="+msg) {
+						got = append(got, msg)
+					}
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("logged %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, "json", false, false)
+	logger.Warn("failed to remove stale unit", "unit", "app-web.container")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["level"] != "WARN" || record["unit"] != "app-web.container" {
+		t.Errorf("unexpected record %v", record)
+	}
+}
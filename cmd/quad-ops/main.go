@@ -22,8 +22,13 @@ THE SOFTWARE.
 package main
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"github.com/alecthomas/kong"
 	kongyaml "github.com/alecthomas/kong-yaml"
@@ -33,16 +38,34 @@ import (
 )
 
 type Globals struct {
-	Config  string            `help:"path to config file" type:"path"`
-	Debug   bool              `help:"enable debug mode"`
-	Verbose bool              `help:"enable verbose output"`
-	AppCfg  *config.AppConfig `kong:"-"` // populated by kong configuration loader
+	Config     string            `help:"path to config file" type:"path"`
+	Debug      bool              `help:"enable debug logging"`
+	Verbose    bool              `help:"enable verbose output"`
+	LogFormat  string            `help:"log output format" enum:"text,json" default:"text"`
+	AppCfg     *config.AppConfig `kong:"-"` // populated by kong configuration loader
+	ConfigPath string            `kong:"-"` // resolved path AppCfg was loaded from
+
+	ctx context.Context // cancelled on SIGINT or SIGTERM
+}
+
+// Context returns the root context for a command, which is cancelled when
+// quad-ops receives SIGINT or SIGTERM.
+func (g *Globals) Context() context.Context {
+	if g.ctx == nil {
+		return context.Background()
+	}
+	return g.ctx
 }
 
 type CLI struct {
 	Globals
 
 	Sync     SyncCmd     `cmd:"" help:"sync repositories, write systemd unit files, and start services"`
+	Daemon   DaemonCmd   `cmd:"" help:"continuously sync repositories on an interval"`
+	Rollback RollbackCmd `cmd:"" help:"roll a repository back to an earlier deployed generation"`
+	Status   StatusCmd   `cmd:"" help:"show deployed revisions and live unit status"`
+	State    StateCmd    `cmd:"" help:"inspect and repair the state file"`
+	GC       GCCmd       `cmd:"" name:"gc" help:"find units quad-ops generated but no longer tracks, and adopt or remove them"`
 	Update   UpdateCmd   `cmd:"" help:"update quad-ops to the latest version"`
 	Validate ValidateCmd `cmd:"" help:"validate compose files for use with quad-ops"`
 	Version  VersionCmd  `cmd:"" help:"print version information"`
@@ -76,6 +99,8 @@ func main() {
 		kong.Configuration(kongyaml.Loader, defaultConfigPath),
 	)
 
+	slog.SetDefault(newLogger(os.Stderr, cli.LogFormat, cli.Verbose, cli.Debug))
+
 	// Load the config file to populate AppConfig
 	configPath := cli.Config
 	if configPath == "" {
@@ -91,17 +116,38 @@ func main() {
 		configPath = filepath.Join(home, configPath[1:])
 	}
 
-	data, err := os.ReadFile(configPath)
+	cfg, err := loadConfig(configPath)
 	if err != nil {
-		ctx.Fatalf("failed to read config file %s: %v", configPath, err)
+		ctx.Fatalf("%v", err)
+	}
+	cli.AppCfg = cfg
+	cli.ConfigPath = configPath
+
+	// The first SIGINT or SIGTERM cancels in-flight work; restoring the
+	// default handlers lets a second one terminate immediately.
+	runCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-runCtx.Done()
+		stop()
+	}()
+	cli.ctx = runCtx
+
+	err = ctx.Run(&cli.Globals)
+	ctx.FatalIfErrorf(err)
+}
+
+// loadConfig reads and parses the application config file at path.
+func loadConfig(path string) (*config.AppConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
 	}
 
 	cfg := &config.AppConfig{}
 	if err := yaml.Unmarshal(data, cfg); err != nil {
-		ctx.Fatalf("failed to parse config file %s: %v", configPath, err)
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
 	}
-	cli.AppCfg = cfg
 
-	err = ctx.Run(&cli.Globals)
-	ctx.FatalIfErrorf(err)
+	return cfg, nil
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+// syncReport is the machine-readable summary of a sync or rollback run
+// written by --report. In dry-run mode it describes what the run would
+// have done.
+type syncReport struct {
+	Action       string        `json:"action"`
+	DryRun       bool          `json:"dry_run"`
+	StartedAt    time.Time     `json:"started_at"`
+	FinishedAt   time.Time     `json:"finished_at"`
+	Success      bool          `json:"success"`
+	Error        string        `json:"error,omitempty"`
+	Repositories []*repoReport `json:"repositories"`
+}
+
+// repoReport describes the outcome of a run for a single repository.
+type repoReport struct {
+	Name              string           `json:"name"`
+	OldCommit         string           `json:"old_commit,omitempty"`
+	NewCommit         string           `json:"new_commit,omitempty"`
+	UnitsWritten      []string         `json:"units_written,omitempty"`
+	StaleUnitsRemoved []string         `json:"stale_units_removed,omitempty"`
+	ServicesRestarted []string         `json:"services_restarted,omitempty"`
+	ServicesStarted   []string         `json:"services_started,omitempty"`
+	ImagesPulled      []pulledImage    `json:"images_pulled,omitempty"`
+	SkippedServices   []skippedService `json:"skipped_services,omitempty"`
+	UnhealthyServices []string         `json:"unhealthy_services,omitempty"`
+	RolledBackTo      string           `json:"rolled_back_to,omitempty"`
+	Errors            []string         `json:"errors,omitempty"`
+
+	// services and images are the container services and images the
+	// repository deploys, used to attribute finalize results.
+	services []string
+	images   []string
+}
+
+// pulledImage records an image pulled during the run.
+type pulledImage struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// skippedService records a compose service that was not deployed because
+// podman secrets it requires do not exist.
+type skippedService struct {
+	Project        string   `json:"project"`
+	Service        string   `json:"service"`
+	MissingSecrets []string `json:"missing_secrets"`
+}
+
+func newSyncReport(action string, dryRun bool) *syncReport {
+	return &syncReport{
+		Action:       action,
+		DryRun:       dryRun,
+		StartedAt:    time.Now().UTC(),
+		Repositories: []*repoReport{},
+	}
+}
+
+// repo returns the report for the named repository, adding it if needed.
+func (r *syncReport) repo(name string) *repoReport {
+	for _, rr := range r.Repositories {
+		if rr.Name == name {
+			return rr
+		}
+	}
+	rr := &repoReport{Name: name}
+	r.Repositories = append(r.Repositories, rr)
+	return rr
+}
+
+// recordRemoved attributes removed stale units to the repositories that
+// managed them before the run.
+func (r *syncReport) recordRemoved(owners map[string]string, units []string) {
+	for _, unit := range units {
+		if owner, ok := owners[unit]; ok {
+			rr := r.repo(owner)
+			rr.StaleUnitsRemoved = append(rr.StaleUnitsRemoved, unit)
+		}
+	}
+}
+
+// recordServices attributes restarted and started services to the
+// repositories that deploy them.
+func (r *syncReport) recordServices(restarted, started []string) {
+	for _, rr := range r.Repositories {
+		for _, svc := range rr.services {
+			if slices.Contains(restarted, svc) {
+				rr.ServicesRestarted = append(rr.ServicesRestarted, svc)
+			}
+			if slices.Contains(started, svc) {
+				rr.ServicesStarted = append(rr.ServicesStarted, svc)
+			}
+		}
+	}
+}
+
+// recordImages attributes pulled images to every repository that uses them.
+// digests maps each pulled image to its digest, which may be empty if it
+// is unknown.
+func (r *syncReport) recordImages(digests map[string]string) {
+	for _, rr := range r.Repositories {
+		for _, image := range rr.images {
+			if digest, ok := digests[image]; ok {
+				rr.ImagesPulled = append(rr.ImagesPulled, pulledImage{Image: image, Digest: digest})
+			}
+		}
+	}
+}
+
+// finish stamps the report with the end time and overall outcome.
+func (r *syncReport) finish(err error) {
+	r.FinishedAt = time.Now().UTC()
+	r.Success = err == nil
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// writeReport writes the report as JSON to path, or to stdout if path is "-".
+func writeReport(path string, r *syncReport) error {
+	if path == "-" {
+		return encodeReport(os.Stdout, r)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report file: %w", err)
+	}
+	if err := encodeReport(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close report file: %w", err)
+	}
+	return nil
+}
+
+func encodeReport(w io.Writer, r *syncReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
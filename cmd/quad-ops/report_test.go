@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSyncReportAttribution(t *testing.T) {
+	r := newSyncReport("sync", false)
+
+	web := r.repo("web")
+	web.services = []string{"web-app.service", "web-worker.service"}
+	web.images = []string{"nginx:1.27", "redis:7"}
+
+	api := r.repo("api")
+	api.services = []string{"api-server.service"}
+	api.images = []string{"redis:7"}
+
+	if r.repo("web") != web {
+		t.Fatal("repo should return the existing report")
+	}
+
+	r.recordRemoved(map[string]string{"old-web.container": "web", "gone.container": "removed"}, []string{"old-web.container", "gone.container"})
+	r.recordServices([]string{"web-app.service"}, []string{"web-worker.service", "api-server.service"})
+	r.recordImages(map[string]string{"redis:7": "sha256:abc"})
+
+	if !slices.Equal(web.StaleUnitsRemoved, []string{"old-web.container"}) {
+		t.Errorf("web stale units = %v", web.StaleUnitsRemoved)
+	}
+	if removed := r.repo("removed"); !slices.Equal(removed.StaleUnitsRemoved, []string{"gone.container"}) {
+		t.Errorf("removed repo stale units = %v", removed.StaleUnitsRemoved)
+	}
+	if !slices.Equal(web.ServicesRestarted, []string{"web-app.service"}) || !slices.Equal(web.ServicesStarted, []string{"web-worker.service"}) {
+		t.Errorf("web services restarted=%v started=%v", web.ServicesRestarted, web.ServicesStarted)
+	}
+	if !slices.Equal(api.ServicesStarted, []string{"api-server.service"}) || len(api.ServicesRestarted) != 0 {
+		t.Errorf("api services restarted=%v started=%v", api.ServicesRestarted, api.ServicesStarted)
+	}
+
+	want := []pulledImage{{Image: "redis:7", Digest: "sha256:abc"}}
+	if !slices.Equal(web.ImagesPulled, want) || !slices.Equal(api.ImagesPulled, want) {
+		t.Errorf("images pulled web=%v api=%v", web.ImagesPulled, api.ImagesPulled)
+	}
+}
+
+func TestWriteReportFile(t *testing.T) {
+	r := newSyncReport("rollback", true)
+	rr := r.repo("web")
+	rr.OldCommit, rr.NewCommit = "bbb", "aaa"
+	rr.Errors = []string{"boom"}
+	r.finish(errors.New("1 repository(ies) failed to rollback"))
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := writeReport(path, r); err != nil {
+		t.Fatalf("writeReport: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got syncReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+	if got.Action != "rollback" || !got.DryRun || got.Success || got.Error == "" {
+		t.Errorf("unexpected report header %+v", got)
+	}
+	if len(got.Repositories) != 1 || got.Repositories[0].NewCommit != "aaa" || got.Repositories[0].Errors[0] != "boom" {
+		t.Errorf("unexpected repositories %+v", got.Repositories)
+	}
+	if got.FinishedAt.Before(got.StartedAt) {
+		t.Errorf("finished_at %s before started_at %s", got.FinishedAt, got.StartedAt)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/trly/quad-ops/internal/config"
+	"github.com/trly/quad-ops/internal/podman"
+	"github.com/trly/quad-ops/internal/systemd"
+)
+
+// staleResource is a Podman volume or network created by a unit that is
+// being deleted.
+type staleResource struct {
+	Unit string
+	Kind string
+	Name string
+}
+
+func (r staleResource) String() string {
+	return r.Kind + " " + r.Name
+}
+
+// resourceID identifies a Podman volume or network by kind and name.
+type resourceID struct {
+	Kind string
+	Name string
+}
+
+// staleResources returns the Podman volumes and networks behind the given
+// units that resource cleanup is enabled for. Resources that are also
+// created by a unit in kept, or by a unit rendered in this run, are still
+// in use and are left out. It reads the unit files, so it must run before
+// they are deleted.
+func staleResources(globals *Globals, units []string, kept map[string]struct{}, rendered []resourceID) []staleResource {
+	cfg := globals.AppCfg.ResourceCleanup
+	if !cfg.Volumes && !cfg.Networks {
+		return nil
+	}
+
+	quadletDir := globals.AppCfg.GetQuadletDir()
+	var resources []staleResource
+	for _, unit := range units {
+		kind, name, err := systemd.ResourceName(filepath.Join(quadletDir, unit))
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				slog.Warn("failed to read stale unit, keeping its resource", "unit", unit, "error", err)
+			}
+			continue
+		}
+		if (kind == "volume" && cfg.Volumes) || (kind == "network" && cfg.Networks) {
+			resources = append(resources, staleResource{Unit: unit, Kind: kind, Name: name})
+		}
+	}
+	if len(resources) == 0 {
+		return nil
+	}
+
+	inUse := usedResources(quadletDir, kept, rendered)
+	return slices.DeleteFunc(resources, func(r staleResource) bool {
+		if _, ok := inUse[resourceID{Kind: r.Kind, Name: r.Name}]; ok {
+			slog.Info("keeping resource still used by a managed unit", "unit", r.Unit, r.Kind, r.Name)
+			return true
+		}
+		return false
+	})
+}
+
+// usedResources returns the volumes and networks created by the given unit
+// files in quadletDir and by the rendered units. Unit files that cannot be
+// read are skipped.
+func usedResources(quadletDir string, units map[string]struct{}, rendered []resourceID) map[resourceID]struct{} {
+	used := make(map[resourceID]struct{}, len(rendered))
+	for _, id := range rendered {
+		used[id] = struct{}{}
+	}
+	for unit := range units {
+		kind, name, err := systemd.ResourceName(filepath.Join(quadletDir, unit))
+		if err != nil || kind == "" {
+			continue
+		}
+		used[resourceID{Kind: kind, Name: name}] = struct{}{}
+	}
+	return used
+}
+
+// removeResources removes stale Podman volumes and networks. A volume that
+// contains data is exported to the configured backup directory first, and
+// kept if there is no backup directory or the export fails. Failures are
+// logged and do not stop the sync.
+func removeResources(ctx context.Context, cfg config.ResourceCleanupConfig, resources []staleResource) {
+	for _, r := range resources {
+		var err error
+		switch r.Kind {
+		case "volume":
+			err = removeVolume(ctx, cfg, r.Name)
+		case "network":
+			err = podman.RemoveNetwork(ctx, r.Name)
+		}
+		if err != nil {
+			slog.Warn("failed to remove stale resource", "unit", r.Unit, r.Kind, r.Name, "error", err)
+			continue
+		}
+		slog.Info("removed stale resource", "unit", r.Unit, r.Kind, r.Name)
+	}
+}
+
+// removeVolume backs up the named volume if it contains data and then
+// removes it.
+func removeVolume(ctx context.Context, cfg config.ResourceCleanupConfig, name string) error {
+	hasData, err := podman.VolumeHasData(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if hasData {
+		if cfg.VolumeBackupDir == "" {
+			return fmt.Errorf("volume contains data and no volumeBackupDir is configured")
+		}
+		if err := os.MkdirAll(cfg.VolumeBackupDir, 0o700); err != nil {
+			return fmt.Errorf("failed to create volume backup directory: %w", err)
+		}
+		backup := filepath.Join(cfg.VolumeBackupDir, fmt.Sprintf("%s-%s.tar", name, time.Now().UTC().Format("20060102T150405Z")))
+		if err := podman.ExportVolume(ctx, name, backup); err != nil {
+			return err
+		}
+		slog.Info("backed up stale volume", "volume", name, "backup", backup)
+	}
+
+	return podman.RemoveVolume(ctx, name)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trly/quad-ops/internal/config"
+)
+
+// TestStaleResourcesHonorsOptIn tests that only the enabled resource kinds
+// are resolved from stale unit files.
+func TestStaleResourcesHonorsOptIn(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app-data.volume":     "[Volume]\nVolumeName=app-data\n",
+		"app-default.network": "[Network]\nNetworkName=app-default\n",
+		"app-web.container":   "[Container]\nImage=nginx\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	units := []string{"app-data.volume", "app-default.network", "app-web.container", "app-missing.volume"}
+
+	globals := &Globals{AppCfg: &config.AppConfig{QuadletDir: dir}}
+	assert.Empty(t, staleResources(globals, units, nil, nil), "cleanup is opt-in")
+
+	globals.AppCfg.ResourceCleanup = config.ResourceCleanupConfig{Networks: true}
+	assert.Equal(t, []staleResource{
+		{Unit: "app-default.network", Kind: "network", Name: "app-default"},
+	}, staleResources(globals, units, nil, nil))
+
+	globals.AppCfg.ResourceCleanup = config.ResourceCleanupConfig{Networks: true, Volumes: true}
+	assert.Equal(t, []staleResource{
+		{Unit: "app-data.volume", Kind: "volume", Name: "app-data"},
+		{Unit: "app-default.network", Kind: "network", Name: "app-default"},
+	}, staleResources(globals, units, nil, nil))
+}
+
+// TestStaleResourcesKeepsSharedResources tests that a stale unit's volume
+// is kept while another unit still creates a volume with the same name.
+func TestStaleResourcesKeepsSharedResources(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"old-data.volume": "[Volume]\nVolumeName=shared\n",
+		"new-data.volume": "[Volume]\nVolumeName=shared\n",
+		"old-net.network": "[Network]\nNetworkName=old-net\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	units := []string{"old-data.volume", "old-net.network"}
+
+	globals := &Globals{AppCfg: &config.AppConfig{
+		QuadletDir:      dir,
+		ResourceCleanup: config.ResourceCleanupConfig{Networks: true, Volumes: true},
+	}}
+
+	kept := map[string]struct{}{"new-data.volume": {}}
+	assert.Equal(t, []staleResource{
+		{Unit: "old-net.network", Kind: "network", Name: "old-net"},
+	}, staleResources(globals, units, kept, nil), "managed unit shares the volume")
+
+	rendered := []resourceID{{Kind: "network", Name: "old-net"}}
+	assert.Equal(t, []staleResource{
+		{Unit: "old-data.volume", Kind: "volume", Name: "shared"},
+	}, staleResources(globals, units, nil, rendered), "rendered unit shares the network")
+
+	assert.Empty(t, staleResources(globals, units, kept, rendered))
+}
@@ -0,0 +1,24 @@
+package main
+
+// RollbackCmd re-deploys an earlier generation of a single repository.
+// Unlike sync --rollback, which steps each repository back one generation,
+// it can target any generation still recorded in the deployment history.
+type RollbackCmd struct {
+	Repo   string `help:"repository to roll back" required:""`
+	To     string `help:"generation ID or commit (prefix of at least 4 characters) to restore; defaults to the generation before the active one" placeholder:"GEN|COMMIT"`
+	DryRun bool   `help:"show what would change without writing units, touching services, or pulling images" default:"false"`
+	Wait   bool   `help:"wait for a concurrent sync to finish instead of failing immediately" default:"false"`
+	Report string `help:"write a JSON report of the run to a file, or - for stdout" placeholder:"FILE"`
+}
+
+// Run executes the rollback command.
+func (r *RollbackCmd) Run(globals *Globals) error {
+	s := &SyncCmd{
+		Rollback:   true,
+		DryRun:     r.DryRun,
+		Wait:       r.Wait,
+		Report:     r.Report,
+		rollbackTo: r.To,
+	}
+	return s.run(globals.Context(), globals, []string{r.Repo})
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/trly/quad-ops/internal/state"
+)
+
+// StateCmd groups subcommands that inspect and repair the state file.
+type StateCmd struct {
+	Show       StateShowCmd       `cmd:"" help:"show the repositories, units, and images recorded in state"`
+	Forget     StateForgetCmd     `cmd:"" help:"remove a repository and its managed units from state"`
+	ForgetUnit StateForgetUnitCmd `cmd:"" name:"forget-unit" help:"remove a single unit from state"`
+	Export     StateExportCmd     `cmd:"" help:"write the state file as JSON"`
+	Import     StateImportCmd     `cmd:"" help:"replace the state file with an exported copy"`
+}
+
+// StateShowCmd prints the bookkeeping quad-ops keeps for each repository.
+type StateShowCmd struct{}
+
+// Run executes the state show command.
+func (c *StateShowCmd) Run(globals *Globals) error {
+	deployState, err := loadState(globals)
+	if err != nil {
+		return err
+	}
+	return renderState(os.Stdout, deployState)
+}
+
+// StateForgetCmd removes a repository from state.
+type StateForgetCmd struct {
+	Repo string `arg:"" help:"repository to forget"`
+	Wait bool   `help:"wait for a concurrent sync to finish instead of failing immediately" default:"false"`
+}
+
+// Run executes the state forget command.
+func (c *StateForgetCmd) Run(globals *Globals) error {
+	return updateState(globals, c.Wait, func(deployState *state.State) error {
+		if !deployState.ForgetRepo(c.Repo) {
+			return fmt.Errorf("repository %q is not recorded in state", c.Repo)
+		}
+		fmt.Printf("Forgot repository %s\n", c.Repo)
+		return nil
+	})
+}
+
+// StateForgetUnitCmd removes a single unit from state.
+type StateForgetUnitCmd struct {
+	Unit string `arg:"" help:"unit file name to forget, for example app-web.container"`
+	Wait bool   `help:"wait for a concurrent sync to finish instead of failing immediately" default:"false"`
+}
+
+// Run executes the state forget-unit command.
+func (c *StateForgetUnitCmd) Run(globals *Globals) error {
+	return updateState(globals, c.Wait, func(deployState *state.State) error {
+		if !deployState.ForgetUnit(c.Unit) {
+			return fmt.Errorf("unit %q is not recorded in state", c.Unit)
+		}
+		fmt.Printf("Forgot unit %s\n", c.Unit)
+		return nil
+	})
+}
+
+// StateExportCmd writes the state as JSON.
+type StateExportCmd struct {
+	File string `arg:"" optional:"" help:"file to write; defaults to stdout" type:"path"`
+}
+
+// Run executes the state export command.
+func (c *StateExportCmd) Run(globals *Globals) error {
+	deployState, err := loadState(globals)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(deployState, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	data = append(data, '\n')
+
+	if c.File == "" || c.File == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(c.File, data, 0o644); err != nil { //nolint:gosec // state holds no secrets
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+// StateImportCmd replaces the state with an exported copy.
+type StateImportCmd struct {
+	File string `arg:"" help:"exported state file to import, or - for stdin"`
+	Wait bool   `help:"wait for a concurrent sync to finish instead of failing immediately" default:"false"`
+}
+
+// Run executes the state import command.
+func (c *StateImportCmd) Run(globals *Globals) error {
+	imported, err := readStateFile(c.File, os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	if globals.AppCfg == nil {
+		return fmt.Errorf("configuration not loaded")
+	}
+
+	ctx := globals.Context()
+	lock, err := lockState(ctx, globals, c.Wait)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	if err := imported.Save(globals.AppCfg.GetStateFilePath()); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	fmt.Printf("Imported state for %d repositories\n", len(imported.Repositories))
+	return nil
+}
+
+// readStateFile parses an exported state from path, or from stdin if path
+// is "-".
+func readStateFile(path string, stdin io.Reader) (*state.State, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(path) //nolint:gosec // path supplied by the operator
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read import: %w", err)
+	}
+	return state.Parse(data)
+}
+
+// loadState reads the configured state file.
+func loadState(globals *Globals) (*state.State, error) {
+	if globals.AppCfg == nil {
+		return nil, fmt.Errorf("configuration not loaded")
+	}
+	deployState, err := state.Load(globals.AppCfg.GetStateFilePath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+	return deployState, nil
+}
+
+// updateState applies fn to the state under the state lock and saves the
+// result if fn succeeds.
+func updateState(globals *Globals, wait bool, fn func(*state.State) error) error {
+	if globals.AppCfg == nil {
+		return fmt.Errorf("configuration not loaded")
+	}
+
+	ctx := globals.Context()
+	lock, err := lockState(ctx, globals, wait)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	deployState, err := loadState(globals)
+	if err != nil {
+		return err
+	}
+	if err := fn(deployState); err != nil {
+		return err
+	}
+	if err := deployState.Save(globals.AppCfg.GetStateFilePath()); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
+
+// renderState writes the repositories, units, and images recorded in state
+// as tables. Units with a stored state but no owning repository are listed
+// with "-" as their repository.
+func renderState(w io.Writer, deployState *state.State) error {
+	owners := deployState.UnitOwners()
+	units := make(map[string]struct{}, len(owners))
+	for unit := range owners {
+		units[unit] = struct{}{}
+	}
+	for unit := range deployState.UnitStates {
+		units[unit] = struct{}{}
+	}
+
+	names := make(map[string]struct{})
+	for name := range deployState.Repositories {
+		names[name] = struct{}{}
+	}
+	for name := range deployState.ManagedUnits {
+		names[name] = struct{}{}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "Schema version: %d\n\n", deployState.SchemaVersion)
+
+	_, _ = fmt.Fprintln(tw, "REPOSITORY\tGENERATION\tCOMMIT\tDEPLOYED\tGENERATIONS\tUNITS")
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		rs := deployState.GetRepo(name)
+		id, commit, deployed := "-", "", "-"
+		if g, ok := rs.ActiveGeneration(); ok {
+			id, commit = fmt.Sprint(g.ID), g.Commit
+			if !g.DeployedAt.IsZero() {
+				deployed = g.DeployedAt.Local().Format("2006-01-02 15:04")
+			}
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\n", name, id, shortCommit(commit), deployed, len(rs.Generations), len(deployState.GetManagedUnits(name)))
+	}
+
+	_, _ = fmt.Fprintln(tw)
+	_, _ = fmt.Fprintln(tw, "UNIT\tREPOSITORY\tCONTENT HASH")
+	for _, unit := range slices.Sorted(maps.Keys(units)) {
+		owner := cmp.Or(owners[unit], "-")
+		hash := "-"
+		if us, ok := deployState.GetUnitState(unit); ok {
+			hash = shortDigest(us.ContentHash)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", unit, owner, hash)
+	}
+
+	_, _ = fmt.Fprintln(tw)
+	_, _ = fmt.Fprintln(tw, "IMAGE\tDIGEST")
+	for _, image := range slices.Sorted(maps.Keys(deployState.ImageDigests)) {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", image, shortDigest(deployState.GetImageDigest(image)))
+	}
+
+	return tw.Flush()
+}
+
+// shortDigest abbreviates a content hash or image digest for display,
+// returning "-" if empty.
+func shortDigest(digest string) string {
+	if digest == "" {
+		return "-"
+	}
+	if _, hex, ok := strings.Cut(digest, ":"); ok {
+		digest = hex
+	}
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trly/quad-ops/internal/state"
+)
+
+// TestRenderStateListsOrphanedUnits tests that units with a stored state
+// but no owning repository are shown.
+func TestRenderStateListsOrphanedUnits(t *testing.T) {
+	s := testStatusState()
+	s.UnitStates = map[string]state.UnitState{
+		"app-web.container": {ContentHash: "0123456789abcdef0123"},
+		"old-api.container": {ContentHash: "fedcba9876543210"},
+	}
+	s.ImageDigests = map[string]string{"nginx:latest": "sha256:aaaabbbbccccdddd"}
+
+	var buf bytes.Buffer
+	require.NoError(t, renderState(&buf, s))
+	out := buf.String()
+
+	assert.Contains(t, out, "infra")
+	assert.Contains(t, out, "1111111")
+	assert.Regexp(t, `app-web\.container\s+infra\s+0123456789ab\n`, out)
+	assert.Regexp(t, `old-api\.container\s+-\s+fedcba987654\n`, out)
+	assert.Regexp(t, `app-data\.volume\s+infra\s+-\n`, out)
+	assert.Regexp(t, `nginx:latest\s+aaaabbbbcccc\n`, out)
+}
+
+// TestReadStateFileRoundTrip tests that exported state can be imported.
+func TestReadStateFileRoundTrip(t *testing.T) {
+	exported, err := json.Marshal(testStatusState())
+	require.NoError(t, err)
+
+	imported, err := readStateFile("-", bytes.NewReader(exported))
+	require.NoError(t, err)
+	assert.Equal(t, "1111111aaaaaaa", imported.GetCurrent("infra"))
+	assert.Equal(t, []string{"app-web.container", "app-data.volume"}, imported.GetManagedUnits("infra"))
+}
+
+// TestReadStateFileRejectsInvalidJSON tests that a damaged export is not
+// imported.
+func TestReadStateFileRejectsInvalidJSON(t *testing.T) {
+	_, err := readStateFile("-", strings.NewReader(`{"repositories":`))
+	assert.ErrorContains(t, err, "failed to parse state file")
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/trly/quad-ops/internal/state"
+	"github.com/trly/quad-ops/internal/systemd"
+)
+
+// StatusCmd reports the deployed revision of each repository and the live
+// systemd state of the units it manages.
+type StatusCmd struct {
+	Output string `help:"output format" enum:"table,json" default:"table" short:"o"`
+}
+
+// repoStatus describes a repository's deployed revisions and managed units.
+type repoStatus struct {
+	Name        string             `json:"name"`
+	Generation  int                `json:"generation,omitempty"`
+	Current     string             `json:"current"`
+	Previous    string             `json:"previous,omitempty"`
+	Units       []unitStatus       `json:"units"`
+	Generations []state.Generation `json:"generations,omitempty"`
+}
+
+// unitStatus describes the live state of a single managed unit.
+type unitStatus struct {
+	Unit        string `json:"unit"`
+	Service     string `json:"service"`
+	ActiveState string `json:"active_state"`
+	SubState    string `json:"sub_state"`
+}
+
+// unknownState is reported when the live state of a unit cannot be queried.
+const unknownState = "unknown"
+
+// Run executes the status command.
+func (c *StatusCmd) Run(globals *Globals) error {
+	if globals.AppCfg == nil {
+		return fmt.Errorf("configuration not loaded")
+	}
+
+	ctx := globals.Context()
+
+	deployState, err := state.Load(globals.AppCfg.GetStateFilePath())
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+
+	// Revisions are still useful without live unit states, so a failed
+	// connection only degrades the output.
+	client, err := systemd.New(ctx, systemd.ScopeAuto)
+	if err != nil {
+		slog.Warn("failed to connect to systemd, unit status unavailable", "error", err)
+	} else {
+		defer func() { _ = client.Close() }()
+	}
+
+	return c.render(os.Stdout, c.collect(ctx, deployState, client))
+}
+
+// collect builds the status of every repository recorded in state. A nil
+// client, or one that fails to report unit status, leaves every unit's live
+// state unknown.
+func (c *StatusCmd) collect(ctx context.Context, deployState *state.State, client systemd.Client) []repoStatus {
+	names := make(map[string]struct{})
+	for name := range deployState.Repositories {
+		names[name] = struct{}{}
+	}
+	for name := range deployState.ManagedUnits {
+		names[name] = struct{}{}
+	}
+
+	var services []string
+	repos := make([]repoStatus, 0, len(names))
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		rs := deployState.GetRepo(name)
+		units := slices.Sorted(slices.Values(deployState.GetManagedUnits(name)))
+
+		repo := repoStatus{Name: name, Units: make([]unitStatus, 0, len(units)), Generations: rs.Generations}
+		if g, ok := rs.ActiveGeneration(); ok {
+			repo.Generation, repo.Current = g.ID, g.Commit
+		}
+		if g, ok := rs.PreviousGeneration(); ok {
+			repo.Previous = g.Commit
+		}
+		for _, unit := range units {
+			svc := systemd.ServiceName(unit)
+			services = append(services, svc)
+			repo.Units = append(repo.Units, unitStatus{Unit: unit, Service: svc, ActiveState: unknownState, SubState: unknownState})
+		}
+		repos = append(repos, repo)
+	}
+
+	if client == nil || len(services) == 0 {
+		return repos
+	}
+
+	statuses, err := client.Status(ctx, services...)
+	if err != nil {
+		slog.Warn("failed to query unit status, unit status unavailable", "error", err)
+		return repos
+	}
+	byName := make(map[string]systemd.UnitStatus, len(statuses))
+	for _, st := range statuses {
+		byName[st.Name] = st
+	}
+
+	for i := range repos {
+		for j := range repos[i].Units {
+			if st, ok := byName[repos[i].Units[j].Service]; ok {
+				repos[i].Units[j].ActiveState = st.ActiveState
+				repos[i].Units[j].SubState = st.SubState
+			}
+		}
+	}
+
+	return repos
+}
+
+// render writes the repository statuses in the selected output format.
+func (c *StatusCmd) render(w io.Writer, repos []repoStatus) error {
+	if c.Output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(repos)
+	}
+
+	if len(repos) == 0 {
+		_, err := fmt.Fprintln(w, "No deployed repositories")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "REPOSITORY\tGENERATION\tCURRENT\tPREVIOUS\tUNITS")
+	for _, repo := range repos {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%d\n", repo.Name, repo.Generation, shortCommit(repo.Current), shortCommit(repo.Previous), len(repo.Units))
+	}
+	_, _ = fmt.Fprintln(tw)
+	_, _ = fmt.Fprintln(tw, "REPOSITORY\tUNIT\tSERVICE\tACTIVE\tSUB")
+	for _, repo := range repos {
+		for _, u := range repo.Units {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", repo.Name, u.Unit, u.Service, u.ActiveState, u.SubState)
+		}
+	}
+	return tw.Flush()
+}
+
+// shortCommit abbreviates a commit hash for display, returning "-" if empty.
+func shortCommit(hash string) string {
+	switch {
+	case hash == "":
+		return "-"
+	case len(hash) > 7:
+		return hash[:7]
+	default:
+		return hash
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/trly/quad-ops/internal/state"
+	"github.com/trly/quad-ops/internal/systemd"
+)
+
+// statusClient is a systemd.Client that reports fixed unit states.
+type statusClient struct {
+	noopClient
+	statuses []systemd.UnitStatus
+}
+
+func (c statusClient) Status(context.Context, ...string) ([]systemd.UnitStatus, error) {
+	return c.statuses, nil
+}
+
+func testStatusState() *state.State {
+	return &state.State{
+		Repositories: map[string]state.RepoState{
+			"infra": {Active: 2, Generations: []state.Generation{
+				{ID: 1, Commit: "2222222bbbbbbb"},
+				{ID: 2, Commit: "1111111aaaaaaa"},
+			}},
+		},
+		ManagedUnits: map[string][]string{
+			"infra": {"app-web.container", "app-data.volume"},
+		},
+	}
+}
+
+// TestStatusCollectMergesLiveState tests that live unit states are matched to managed units.
+func TestStatusCollectMergesLiveState(t *testing.T) {
+	client := statusClient{statuses: []systemd.UnitStatus{
+		{Name: "app-web.service", ActiveState: "active", SubState: "running"},
+		{Name: "app-data-volume.service", ActiveState: "active", SubState: "exited"},
+	}}
+
+	cmd := &StatusCmd{}
+	repos := cmd.collect(context.Background(), testStatusState(), client)
+	require.Len(t, repos, 1)
+
+	repo := repos[0]
+	assert.Equal(t, "infra", repo.Name)
+	assert.Equal(t, 2, repo.Generation)
+	assert.Equal(t, "1111111aaaaaaa", repo.Current)
+	assert.Equal(t, "2222222bbbbbbb", repo.Previous)
+	assert.Equal(t, []unitStatus{
+		{Unit: "app-data.volume", Service: "app-data-volume.service", ActiveState: "active", SubState: "exited"},
+		{Unit: "app-web.container", Service: "app-web.service", ActiveState: "active", SubState: "running"},
+	}, repo.Units)
+}
+
+// TestStatusCollectWithoutClient tests that unit states are unknown without a systemd connection.
+func TestStatusCollectWithoutClient(t *testing.T) {
+	cmd := &StatusCmd{}
+	repos := cmd.collect(context.Background(), testStatusState(), nil)
+	require.Len(t, repos, 1)
+
+	for _, u := range repos[0].Units {
+		assert.Equal(t, unknownState, u.ActiveState)
+		assert.Equal(t, unknownState, u.SubState)
+	}
+}
+
+// failingStatusClient is a systemd.Client whose status queries fail.
+type failingStatusClient struct{ noopClient }
+
+func (failingStatusClient) Status(context.Context, ...string) ([]systemd.UnitStatus, error) {
+	return nil, errors.New("connection reset")
+}
+
+// TestStatusCollectStatusFailure tests that a failed status query still
+// reports the state file data with unknown unit states.
+func TestStatusCollectStatusFailure(t *testing.T) {
+	cmd := &StatusCmd{}
+	repos := cmd.collect(context.Background(), testStatusState(), failingStatusClient{})
+	require.Len(t, repos, 1)
+
+	assert.Equal(t, "1111111aaaaaaa", repos[0].Current)
+	require.Len(t, repos[0].Units, 2)
+	for _, u := range repos[0].Units {
+		assert.Equal(t, unknownState, u.ActiveState)
+		assert.Equal(t, unknownState, u.SubState)
+	}
+}
+
+// TestStatusRenderTable tests the table output format.
+func TestStatusRenderTable(t *testing.T) {
+	cmd := &StatusCmd{Output: "table"}
+	repos := cmd.collect(context.Background(), testStatusState(), nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, cmd.render(&buf, repos))
+
+	out := buf.String()
+	assert.Contains(t, out, "REPOSITORY")
+	assert.Contains(t, out, "1111111")
+	assert.Contains(t, out, "2222222")
+	assert.NotContains(t, out, "1111111aaaaaaa")
+	assert.Contains(t, out, "app-web.service")
+}
+
+// TestStatusRenderJSON tests the JSON output format.
+func TestStatusRenderJSON(t *testing.T) {
+	cmd := &StatusCmd{Output: "json"}
+	repos := cmd.collect(context.Background(), testStatusState(), nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, cmd.render(&buf, repos))
+
+	var decoded []repoStatus
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, repos, decoded)
+}
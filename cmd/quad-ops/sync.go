@@ -2,12 +2,20 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/trly/quad-ops/internal/compose"
+	"github.com/trly/quad-ops/internal/config"
 	"github.com/trly/quad-ops/internal/git"
 	"github.com/trly/quad-ops/internal/podman"
 	"github.com/trly/quad-ops/internal/state"
@@ -16,24 +24,68 @@ import (
 
 // SyncCmd represents the sync command that processes repositories and writes systemd unit files.
 type SyncCmd struct {
-	Rollback bool `help:"rollback to the previous known good configuration" default:"false"`
+	Rollback bool     `help:"rollback each repository to the generation before the active one" default:"false"`
+	DryRun   bool     `help:"show what would change without writing units, touching services, or pulling images" default:"false"`
+	Repo     []string `help:"only sync the named repository (repeatable); other repositories and their units are left untouched"`
+	Wait     bool     `help:"wait for a concurrent sync to finish instead of failing immediately" default:"false"`
+	Report   string   `help:"write a JSON report of the run to a file, or - for stdout" placeholder:"FILE"`
+
+	// client is a long-lived systemd connection reused across runs by the
+	// daemon. When nil, finalize opens and closes its own connection.
+	client systemd.Client
+	// rollbackTo selects the generation ID or commit a rollback restores
+	// instead of the previous generation. Set by the rollback command.
+	rollbackTo string
 }
 
 // repoResult holds the per-repository outputs accumulated during sync/rollback.
 type repoResult struct {
-	services   []string
-	images     []string
-	unitStates map[string]state.UnitState
+	oldCommit    string
+	newCommit    string
+	units        []string
+	services     []string
+	images       []string
+	unitStates   map[string]state.UnitState
+	unitsAdded   []string
+	unitsChanged []string
+	skipped      []skippedService
+	resources    []resourceID
 }
 
 // syncResult accumulates the outputs from processing all repositories.
 type syncResult struct {
 	oldManagedUnits map[string]struct{}
+	oldUnitOwners   map[string]string
+	repoImages      map[string][]string
+	// deployed maps repositories that activated a new generation to their
+	// container services, which are watched when auto-rollback is enabled.
+	deployed map[string][]string
+	// activated is set once finalize has started or restarted services.
+	activated       bool
 	newUnitStates   map[string]state.UnitState
 	servicesToStart []string
 	images          []string
-	failed          int
-	action          string
+	unitsAdded      []string
+	unitsChanged    []string
+	// resources are the volumes and networks created by the rendered units.
+	resources []resourceID
+	failed    int
+	action    string
+	report    *syncReport
+}
+
+// generatedUnits holds the outputs of rendering a repository's compose projects.
+type generatedUnits struct {
+	names      []string
+	images     []string
+	unitStates map[string]state.UnitState
+	// added and changed are only populated in dry-run mode, where units are
+	// compared against the quadlet directory instead of being written.
+	added   []string
+	changed []string
+	skipped []skippedService
+	// resources are the volumes and networks the units create.
+	resources []resourceID
 }
 
 // Run executes the sync command by:
@@ -42,18 +94,81 @@ type syncResult struct {
 // 3. Converting compose specs to systemd units.
 // 4. Writing units to the quadlet directory.
 func (s *SyncCmd) Run(globals *Globals) error {
+	return s.run(globals.Context(), globals, s.Repo)
+}
+
+// run validates the configuration and reconciles the named repositories,
+// or all configured repositories if repoNames is empty.
+func (s *SyncCmd) run(ctx context.Context, globals *Globals, repoNames []string) error {
 	if globals.AppCfg == nil {
 		return fmt.Errorf("configuration not loaded")
 	}
 
-	if len(globals.AppCfg.Repositories) == 0 {
-		if globals.Verbose {
-			fmt.Println("No repositories configured")
+	if len(globals.AppCfg.Repositories) == 0 && len(repoNames) == 0 {
+		slog.Info("no repositories configured")
+		return nil
+	}
+
+	lock, err := lockState(ctx, globals, s.Wait)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	if err := s.checkRepoNames(globals, repoNames); err != nil {
+		return err
+	}
+
+	return s.reconcile(ctx, globals, repoNames)
+}
+
+// lockState acquires the state lock, waiting for a concurrent run to
+// finish if wait is set.
+func lockState(ctx context.Context, globals *Globals, wait bool) (*state.FileLock, error) {
+	lock, err := state.Lock(ctx, globals.AppCfg.GetStateFilePath(), wait)
+	if err != nil {
+		if errors.Is(err, state.ErrLocked) {
+			return nil, fmt.Errorf("another sync is already running: %w; retry later or pass --wait", err)
 		}
+		return nil, fmt.Errorf("failed to acquire state lock: %w", err)
+	}
+	return lock, nil
+}
+
+// checkRepoNames verifies that each requested repository is either
+// configured or still recorded in state, so a typo cannot silently turn a
+// targeted run into a no-op. Names only found in state belong to removed
+// repositories whose units a targeted run will clean up.
+func (s *SyncCmd) checkRepoNames(globals *Globals, repoNames []string) error {
+	if len(repoNames) == 0 {
 		return nil
 	}
 
-	return s.reconcile(globals)
+	known := make(map[string]struct{}, len(globals.AppCfg.Repositories))
+	for _, repo := range globals.AppCfg.Repositories {
+		known[repo.Name] = struct{}{}
+	}
+
+	var missing []string
+	for _, name := range repoNames {
+		if _, ok := known[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	deployState, err := state.Load(globals.AppCfg.GetStateFilePath())
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	for _, name := range missing {
+		if _, ok := deployState.ManagedUnits[name]; !ok {
+			return fmt.Errorf("unknown repository %q", name)
+		}
+	}
+	return nil
 }
 
 // repoConfig captures the per-repo fields needed by processors.
@@ -62,14 +177,20 @@ type repoConfig struct {
 	URL        string
 	Ref        string
 	ComposeDir string
+	Auth       config.GitAuthConfig
+	Depth      int
+	Sparse     bool
+	// FetchTimeout is the resolved clone or fetch timeout.
+	FetchTimeout time.Duration
+	Verify       config.VerifyConfig
 }
 
 // reconcile iterates over configured repositories,
 // calls the provided processor for each, then
 // finalizes (stale cleanup, daemon reload, service start/restart).
-func (s *SyncCmd) reconcile(globals *Globals) error {
-	ctx := context.Background()
-
+// When repoNames is non-empty only those repositories are processed, and
+// only units they previously managed are candidates for stale cleanup.
+func (s *SyncCmd) reconcile(ctx context.Context, globals *Globals, repoNames []string) (err error) {
 	stateFilePath := globals.AppCfg.GetStateFilePath()
 	deployState, err := state.Load(stateFilePath)
 	if err != nil {
@@ -83,20 +204,67 @@ func (s *SyncCmd) reconcile(globals *Globals) error {
 		action = "rollback"
 	}
 
+	oldManagedUnits := deployState.CollectAllManagedUnits()
+	if len(repoNames) > 0 {
+		oldManagedUnits = deployState.CollectManagedUnitsFor(repoNames)
+	}
+
 	sr := &syncResult{
-		oldManagedUnits: deployState.CollectAllManagedUnits(),
+		oldManagedUnits: oldManagedUnits,
+		oldUnitOwners:   deployState.UnitOwners(),
 		newUnitStates:   make(map[string]state.UnitState),
+		repoImages:      make(map[string][]string),
+		deployed:        make(map[string][]string),
 		action:          action,
+		report:          newSyncReport(action, s.DryRun),
+	}
+	if s.Report != "" {
+		defer func() {
+			sr.report.finish(err)
+			if werr := writeReport(s.Report, sr.report); werr != nil {
+				err = errors.Join(err, werr)
+			}
+		}()
 	}
 	imageSet := make(map[string]struct{})
 
+	var repos []repoConfig
 	for _, repo := range globals.AppCfg.Repositories {
-		repoPath := filepath.Join(globals.AppCfg.GetRepositoryDir(), repo.Name)
-		rc := repoConfig{Name: repo.Name, URL: repo.URL, Ref: repo.Ref, ComposeDir: repo.ComposeDir}
+		if len(repoNames) > 0 && !slices.Contains(repoNames, repo.Name) {
+			continue
+		}
+		repos = append(repos, repoConfig{
+			Name:         repo.Name,
+			URL:          repo.URL,
+			Ref:          repo.Ref,
+			ComposeDir:   repo.ComposeDir,
+			Auth:         repo.Auth,
+			Depth:        repo.Depth,
+			Sparse:       repo.Sparse,
+			FetchTimeout: repo.GetFetchTimeout(),
+			Verify:       repo.Verify,
+		})
+	}
 
-		result, err := process(ctx, globals, deployState, rc, repoPath)
-		if err != nil {
-			fmt.Printf("  ERROR: %v\n", err)
+	if !s.DryRun {
+		// The state lock keeps other runs from writing units meanwhile.
+		if err := systemd.RemoveStaging(globals.AppCfg.GetQuadletDir()); err != nil {
+			slog.Warn("failed to remove leftover staging files", "error", err)
+		}
+	}
+
+	results, errs := processRepos(repos, globals.AppCfg.GetParallelism(), func(rc repoConfig) (*repoResult, error) {
+		repoPath := filepath.Join(globals.AppCfg.GetRepositoryDir(), rc.Name)
+		return process(ctx, globals, deployState, rc, repoPath)
+	})
+
+	// Merge in configuration order so output and results are deterministic
+	// regardless of which repository finished first.
+	for i, result := range results {
+		rr := sr.report.repo(repos[i].Name)
+		if errs[i] != nil {
+			slog.Error("repository failed", "repo", repos[i].Name, "action", sr.action, "error", errs[i])
+			rr.Errors = append(rr.Errors, errs[i].Error())
 			sr.failed++
 			continue
 		}
@@ -104,6 +272,15 @@ func (s *SyncCmd) reconcile(globals *Globals) error {
 			continue
 		}
 
+		rr.OldCommit, rr.NewCommit = result.oldCommit, result.newCommit
+		rr.UnitsWritten = result.units
+		rr.SkippedServices = result.skipped
+		rr.services, rr.images = result.services, result.images
+		sr.repoImages[repos[i].Name] = result.images
+		if result.oldCommit != "" && result.oldCommit != result.newCommit {
+			sr.deployed[repos[i].Name] = result.services
+		}
+
 		sr.servicesToStart = append(sr.servicesToStart, result.services...)
 		for _, img := range result.images {
 			imageSet[img] = struct{}{}
@@ -111,30 +288,88 @@ func (s *SyncCmd) reconcile(globals *Globals) error {
 		for k, v := range result.unitStates {
 			sr.newUnitStates[k] = v
 		}
+		sr.unitsAdded = append(sr.unitsAdded, result.unitsAdded...)
+		sr.unitsChanged = append(sr.unitsChanged, result.unitsChanged...)
+		sr.resources = append(sr.resources, result.resources...)
+	}
+
+	// Remember each repository's onRemove policy so it still applies to
+	// the repository's units after it is removed from the configuration.
+	for _, repo := range repos {
+		policy, _ := globals.AppCfg.GetOnRemove(repo.Name)
+		deployState.SetOnRemove(repo.Name, string(policy))
 	}
 
-	// Prune managed units for repos removed from config
+	// Prune managed units for repos removed from config. A targeted run
+	// leaves other repositories' bookkeeping untouched.
 	configuredRepos := make(map[string]struct{}, len(globals.AppCfg.Repositories))
 	for _, repo := range globals.AppCfg.Repositories {
 		configuredRepos[repo.Name] = struct{}{}
 	}
-	deployState.PruneRemovedRepos(configuredRepos)
+	deployState.PruneRemovedRepos(configuredRepos, repoNames...)
 
 	sr.images = make([]string, 0, len(imageSet))
 	for img := range imageSet {
 		sr.images = append(sr.images, img)
 	}
 
-	return s.finalize(ctx, globals, deployState, stateFilePath, sr)
+	err = s.finalize(ctx, globals, deployState, stateFilePath, sr)
+
+	// Rollbacks are never verified, so a rollback cannot trigger another.
+	if sr.activated && !s.Rollback && globals.AppCfg.AutoRollback.Enabled && len(sr.deployed) > 0 {
+		err = errors.Join(err, s.verifyDeploys(ctx, globals, sr))
+	}
+
+	return err
+}
+
+// processRepos runs process for each repository using at most workers
+// goroutines. Results and errors are returned at the index of their
+// repository.
+func processRepos(repos []repoConfig, workers int, process func(repoConfig) (*repoResult, error)) ([]*repoResult, []error) {
+	results := make([]*repoResult, len(repos))
+	errs := make([]error, len(repos))
+
+	sem := make(chan struct{}, max(workers, 1))
+	var wg sync.WaitGroup
+	for i, rc := range repos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = process(rc)
+		}()
+	}
+	wg.Wait()
+
+	return results, errs
 }
 
 // syncRepo processes a single repository for the normal sync path.
 func (s *SyncCmd) syncRepo(ctx context.Context, globals *Globals, deployState *state.State, repo repoConfig, repoPath string) (*repoResult, error) {
-	if globals.Verbose {
-		fmt.Printf("Syncing repository: %s\n", repo.Name)
+	slog.Info("syncing repository", "repo", repo.Name)
+
+	if s.DryRun {
+		defer restoreCheckout(repo, repoPath, deployState.GetCurrent(repo.Name))
 	}
 
 	gitRepo := git.New(repo.Name, repo.URL, repo.Ref, repo.ComposeDir, repoPath)
+	gitRepo.Depth = repo.Depth
+	gitRepo.Sparse = repo.Sparse
+	gitRepo.FetchTimeout = repo.FetchTimeout
+	auth, err := gitAuth(repo.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure git authentication: %w", err)
+	}
+	gitRepo.Auth = auth
+	if repo.Verify.Enabled() {
+		// An untrusted commit fails the repository before it is checked
+		// out, so the previous deployment keeps running.
+		if gitRepo.Verifier, err = git.NewVerifier(repo.Verify.Keys); err != nil {
+			return nil, fmt.Errorf("failed to load signing keys: %w", err)
+		}
+	}
 	if err := gitRepo.Sync(ctx); err != nil {
 		return nil, fmt.Errorf("failed to sync git repository: %w", err)
 	}
@@ -143,57 +378,110 @@ func (s *SyncCmd) syncRepo(ctx context.Context, globals *Globals, deployState *s
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current commit hash: %w", err)
 	}
-	if globals.Verbose {
-		fmt.Printf("  Current revision: %s\n", commitHash[:7])
+	slog.Info("fetched repository", "repo", repo.Name, "commit", commitHash)
+
+	if rs := deployState.GetRepo(repo.Name); commitHash != deployState.GetCurrent(repo.Name) && rs.IsFailedCommit(commitHash) {
+		slog.Warn("skipping commit that failed its health check; push a new commit to deploy again", "repo", repo.Name, "commit", commitHash)
+		return nil, nil
 	}
 
-	unitNames, images, unitStates, genErr := s.generateUnits(ctx, globals, repo, repoPath)
+	// Units are written all-or-nothing, so on failure the repository stays
+	// at its previously deployed commit and keeps its managed units.
+	gen, err := s.generateUnits(ctx, globals, repo, repoPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := gen.result(s.DryRun)
+	result.oldCommit, result.newCommit = deployState.GetCurrent(repo.Name), commitHash
 
 	deployState.SetCommit(repo.Name, commitHash)
-	deployState.SetManagedUnits(repo.Name, unitNames)
+	deployState.SetManagedUnits(repo.Name, gen.names)
+
+	return result, nil
+}
 
-	if genErr != nil {
-		return nil, genErr
+// restoreCheckout returns the clone at repoPath to the deployed commit after
+// a dry run checked out another commit to render it, so the clone keeps
+// matching what is running. Nothing is restored for a repository that was
+// never deployed.
+func restoreCheckout(repo repoConfig, repoPath, commit string) {
+	if commit == "" {
+		return
 	}
+	gitRepo := git.New(repo.Name, repo.URL, commit, repo.ComposeDir, repoPath)
+	gitRepo.Sparse = repo.Sparse
+	if err := gitRepo.CheckoutRef(commit); err != nil {
+		slog.Warn("failed to restore repository after dry run", "repo", repo.Name, "commit", commit, "error", err)
+	}
+}
 
-	return &repoResult{
-		services:   containerServices(unitNames),
-		images:     images,
-		unitStates: unitStates,
+// gitAuth resolves the configured credentials, reading secrets from their
+// files and environment variables.
+func gitAuth(cfg config.GitAuthConfig) (git.Auth, error) {
+	password, err := cfg.GetPassword()
+	if err != nil {
+		return git.Auth{}, err
+	}
+	passphrase, err := cfg.GetSSHKeyPassphrase()
+	if err != nil {
+		return git.Auth{}, err
+	}
+	return git.Auth{
+		SSHKeyFile:       cfg.SSHKeyFile,
+		SSHKeyPassphrase: passphrase,
+		SSHAgent:         cfg.SSHAgent,
+		KnownHostsFile:   cfg.KnownHostsFile,
+		HostKeyPolicy:    git.HostKeyPolicy(cfg.HostKeyPolicy),
+		Username:         cfg.Username,
+		Password:         password,
 	}, nil
 }
 
 // rollbackRepo processes a single repository for the rollback path.
 func (s *SyncCmd) rollbackRepo(ctx context.Context, globals *Globals, deployState *state.State, repo repoConfig, repoPath string) (*repoResult, error) {
-	prev := deployState.GetPrevious(repo.Name)
-	if prev == "" {
-		fmt.Printf("  WARNING: no previous state for %s, skipping\n", repo.Name)
+	rs := deployState.GetRepo(repo.Name)
+	target, ok := rs.PreviousGeneration()
+	if s.rollbackTo != "" {
+		var err error
+		if target, err = rs.FindGeneration(s.rollbackTo); err != nil {
+			return nil, err
+		}
+	} else if !ok {
+		slog.Warn("no previous generation, skipping rollback", "repo", repo.Name)
 		return nil, nil
 	}
 
-	if globals.Verbose {
-		fmt.Printf("Rolling back repository: %s to %s\n", repo.Name, prev[:7])
+	slog.Info("rolling back repository", "repo", repo.Name, "generation", target.ID, "commit", target.Commit)
+	if s.DryRun {
+		defer restoreCheckout(repo, repoPath, deployState.GetCurrent(repo.Name))
 	}
 
-	gitRepo := git.New(repo.Name, repo.URL, prev, repo.ComposeDir, repoPath)
-	if err := gitRepo.CheckoutRef(prev); err != nil {
+	gitRepo := git.New(repo.Name, repo.URL, target.Commit, repo.ComposeDir, repoPath)
+	gitRepo.Sparse = repo.Sparse
+	if err := gitRepo.CheckoutRef(target.Commit); err != nil {
 		return nil, err
 	}
 
-	unitNames, images, unitStates, genErr := s.generateUnits(ctx, globals, repo, repoPath)
+	// Pin images to the digests the generation ran with; its tags may
+	// have moved on since.
+	gen, err := s.generateUnits(ctx, globals, repo, repoPath, target.ImageDigests)
+	if err != nil {
+		return nil, err
+	}
+	if len(target.ImageDigests) == 0 && len(gen.images) > 0 {
+		slog.Warn("generation has no recorded image digests, deploying image tags", "repo", repo.Name, "generation", target.ID)
+	}
 
-	deployState.SetCommit(repo.Name, prev)
-	deployState.SetManagedUnits(repo.Name, unitNames)
+	result := gen.result(s.DryRun)
+	result.oldCommit, result.newCommit = deployState.GetCurrent(repo.Name), target.Commit
 
-	if genErr != nil {
-		return nil, genErr
+	if err := deployState.ActivateGeneration(repo.Name, target.ID); err != nil {
+		return nil, err
 	}
+	deployState.SetManagedUnits(repo.Name, gen.names)
 
-	return &repoResult{
-		services:   containerServices(unitNames),
-		images:     images,
-		unitStates: unitStates,
-	}, nil
+	return result, nil
 }
 
 // finalize performs post-sync/rollback cleanup: stale unit removal, state
@@ -203,14 +491,34 @@ func (s *SyncCmd) finalize(ctx context.Context, globals *Globals, deployState *s
 	newManagedUnits := deployState.CollectAllManagedUnits()
 	staleUnits := state.DiffUnits(sr.oldManagedUnits, newManagedUnits)
 
-	client, err := systemd.New(ctx, systemd.ScopeAuto)
-	if err != nil {
-		return fmt.Errorf("failed to connect to systemd: %w", err)
+	if s.DryRun {
+		// Keep stdout valid JSON when the report is written there.
+		w := io.Writer(os.Stdout)
+		if s.Report == "-" {
+			w = os.Stderr
+		}
+		return s.printPlan(ctx, w, globals, deployState, staleUnits, sr)
+	}
+
+	// Units have been written at this point, so finish applying them and
+	// saving state even if the run is interrupted meanwhile. Only image
+	// pulls, which can hang on an unresponsive registry, are aborted.
+	pullCtx := ctx
+	ctx = context.WithoutCancel(ctx)
+
+	client := s.client
+	if client == nil {
+		var err error
+		client, err = systemd.New(ctx, systemd.ScopeAuto)
+		if err != nil {
+			return fmt.Errorf("failed to connect to systemd: %w", err)
+		}
+		defer func() { _ = client.Close() }()
 	}
-	defer func() { _ = client.Close() }()
 
 	if len(staleUnits) > 0 {
-		s.cleanupStaleUnits(ctx, globals, deployState, client, staleUnits)
+		removed := s.cleanupStaleUnits(ctx, globals, deployState, client, staleUnits, sr.oldUnitOwners, sr.resources)
+		sr.report.recordRemoved(sr.oldUnitOwners, removed)
 	}
 
 	// Determine which services need restart before updating stored hashes
@@ -228,63 +536,115 @@ func (s *SyncCmd) finalize(ctx context.Context, globals *Globals, deployState *s
 	if err := client.DaemonReload(ctx); err != nil {
 		return fmt.Errorf("failed to reload systemd daemon: %w", err)
 	}
-	if globals.Verbose {
-		fmt.Println("Reloaded systemd daemon")
-	}
+	slog.Debug("reloaded systemd daemon")
 
-	pullResult, err := podman.PullImages(sr.images, deployState.ImageDigests, globals.Verbose)
+	pullResult, err := podman.PullImages(pullCtx, sr.images, deployState.ImageDigests)
+	sr.report.recordImages(pullResult.Pulled)
 	if err != nil {
 		return fmt.Errorf("failed to pull images: %w", err)
 	}
 	for image, digest := range pullResult.UpdatedDigests {
+		// Images a rollback pinned to a digest cannot move, so there is
+		// nothing to track for them.
+		if podman.IsPinned(image) {
+			continue
+		}
 		deployState.SetImageDigest(image, digest)
 	}
-	if len(pullResult.UpdatedDigests) > 0 {
+	// A rollback re-activates a recorded generation, whose digests describe
+	// what it originally deployed and are left untouched.
+	if !s.Rollback {
+		for repoName, images := range sr.repoImages {
+			digests := make(map[string]string, len(images))
+			for _, image := range images {
+				if digest := deployState.GetImageDigest(image); digest != "" {
+					digests[image] = digest
+				}
+			}
+			deployState.SetGenerationImageDigests(repoName, digests)
+		}
+	}
+	if len(pullResult.UpdatedDigests) > 0 || len(sr.repoImages) > 0 {
 		if err := deployState.Save(stateFilePath); err != nil {
 			return fmt.Errorf("failed to save state: %w", err)
 		}
 	}
 
+	sr.activated = true
+
 	// Restart services whose unit definitions or bind-mounted files changed
 	if len(changedServices) > 0 {
-		if globals.Verbose {
-			fmt.Printf("Restarting %d changed service(s)...\n", len(changedServices))
-		}
+		slog.Debug("restarting changed services", "services", changedServices)
 		if err := client.Restart(ctx, changedServices...); err != nil {
 			return fmt.Errorf("some services failed to restart: %w", err)
 		}
-		if globals.Verbose {
-			fmt.Printf("Restarted %d changed service(s)\n", len(changedServices))
-		}
+		sr.report.recordServices(changedServices, nil)
+		slog.Info("restarted changed services", "count", len(changedServices))
 	}
 
 	// Exclude already-restarted services from the start list
-	if len(changedServices) > 0 {
-		restartedSet := make(map[string]struct{}, len(changedServices))
-		for _, svc := range changedServices {
-			restartedSet[svc] = struct{}{}
-		}
-		var remaining []string
-		for _, svc := range sr.servicesToStart {
-			if _, restarted := restartedSet[svc]; !restarted {
-				remaining = append(remaining, svc)
-			}
-		}
-		sr.servicesToStart = remaining
-	}
+	sr.servicesToStart = excludeServices(sr.servicesToStart, changedServices)
 
 	// Start all services to ensure everything is running.
 	if len(sr.servicesToStart) > 0 {
-		if globals.Verbose {
-			fmt.Printf("Starting %d service(s)...\n", len(sr.servicesToStart))
-		}
+		slog.Debug("starting services", "services", sr.servicesToStart)
 		if err := client.Start(ctx, sr.servicesToStart...); err != nil {
 			return fmt.Errorf("some services failed to start: %w", err)
 		}
-		if globals.Verbose {
-			fmt.Printf("Started %d service(s)\n", len(sr.servicesToStart))
+		sr.report.recordServices(nil, sr.servicesToStart)
+		slog.Info("started services", "count", len(sr.servicesToStart))
+	}
+
+	if sr.failed > 0 {
+		return fmt.Errorf("%d repository(ies) failed to %s", sr.failed, sr.action)
+	}
+
+	return nil
+}
+
+// printPlan reports what finalize would do for the accumulated results
+// without touching the quadlet directory, systemd, images, or the state file.
+func (s *SyncCmd) printPlan(ctx context.Context, w io.Writer, globals *Globals, deployState *state.State, staleUnits []string, sr *syncResult) error {
+	toDelete, toStop, toKeep := splitStaleUnits(globals, deployState, staleUnits, sr.oldUnitOwners)
+	changedServices := containerServices(deployState.ChangedUnits(sr.newUnitStates))
+	servicesToStart := excludeServices(sr.servicesToStart, changedServices)
+	images, err := podman.OutdatedImages(ctx, sr.images, deployState.ImageDigests)
+	if err != nil {
+		return fmt.Errorf("failed to check images: %w", err)
+	}
+
+	sr.report.recordRemoved(sr.oldUnitOwners, toDelete)
+	sr.report.recordServices(changedServices, servicesToStart)
+	outdated := make(map[string]string, len(images))
+	for _, image := range images {
+		outdated[image] = ""
+	}
+	sr.report.recordImages(outdated)
+
+	_, _ = fmt.Fprintf(w, "Dry run: no changes were made (%s)\n", sr.action)
+	printPlanSection(w, "Units to add", "+", sr.unitsAdded)
+	printPlanSection(w, "Units to change", "~", sr.unitsChanged)
+	printPlanSection(w, "Units to remove", "-", toDelete)
+	kept := deployState.CollectAllManagedUnits()
+	for _, unit := range slices.Concat(toStop, toKeep) {
+		kept[unit] = struct{}{}
+	}
+	if resources := staleResources(globals, toDelete, kept, sr.resources); len(resources) > 0 {
+		names := make([]string, 0, len(resources))
+		for _, r := range resources {
+			names = append(names, r.String())
 		}
+		printPlanSection(w, "Podman resources to remove", "-", names)
+	}
+	if len(toStop) > 0 {
+		printPlanSection(w, "Units to stop (onRemove: stop)", "!", toStop)
 	}
+	if len(toKeep) > 0 {
+		printPlanSection(w, "Units to keep (onRemove: keep)", "=", toKeep)
+	}
+	printPlanSection(w, "Services to restart", "*", changedServices)
+	printPlanSection(w, "Services to start", "*", servicesToStart)
+	printPlanSection(w, "Images to pull", "*", images)
 
 	if sr.failed > 0 {
 		return fmt.Errorf("%d repository(ies) failed to %s", sr.failed, sr.action)
@@ -293,10 +653,21 @@ func (s *SyncCmd) finalize(ctx context.Context, globals *Globals, deployState *s
 	return nil
 }
 
+// printPlanSection prints a sorted list of plan entries under a heading.
+func printPlanSection(w io.Writer, heading, marker string, items []string) {
+	sorted := slices.Sorted(slices.Values(items))
+	_, _ = fmt.Fprintf(w, "%s (%d):\n", heading, len(sorted))
+	for _, item := range sorted {
+		_, _ = fmt.Fprintf(w, "  %s %s\n", marker, item)
+	}
+}
+
 // generateUnits loads compose files, writes the resulting quadlet units,
 // and returns the list of unit filenames written, images referenced, and
-// unit states for change detection.
-func (s *SyncCmd) generateUnits(ctx context.Context, globals *Globals, repo repoConfig, repoPath string) ([]string, []string, map[string]state.UnitState, error) {
+// unit states for change detection. Images with an entry in digests are
+// pinned to that digest. In dry-run mode the units are compared against the
+// quadlet directory instead of being written.
+func (s *SyncCmd) generateUnits(ctx context.Context, globals *Globals, repo repoConfig, repoPath string, digests map[string]string) (*generatedUnits, error) {
 	composeDir := repo.ComposeDir
 	composeSourceDir := repoPath
 	if composeDir != "" {
@@ -305,24 +676,24 @@ func (s *SyncCmd) generateUnits(ctx context.Context, globals *Globals, repo repo
 
 	loadedProjects, err := compose.LoadAll(ctx, composeSourceDir, nil)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to load compose files: %w", err)
+		return &generatedUnits{}, fmt.Errorf("failed to load compose files: %w", err)
 	}
 
 	if len(loadedProjects) == 0 {
-		if globals.Verbose {
-			fmt.Printf("  No compose files found in %s\n", composeSourceDir)
-		}
-		return nil, nil, nil, nil
+		slog.Info("no compose files found", "repo", repo.Name, "dir", composeSourceDir)
+		return &generatedUnits{}, nil
 	}
 
 	quadletDir := globals.AppCfg.GetQuadletDir()
-	var unitNames []string
+	gen := &generatedUnits{unitStates: make(map[string]state.UnitState)}
 	imageSet := make(map[string]struct{})
-	unitStates := make(map[string]state.UnitState)
+	// Units from every project are written together once all of them have
+	// been rendered, so a repository is never left half-deployed.
+	var pending []systemd.Unit
 
 	for _, lp := range loadedProjects {
 		if lp.Error != nil {
-			fmt.Printf("  WARNING: failed to load %s: %v\n", lp.FilePath, lp.Error)
+			slog.Warn("failed to load compose file", "repo", repo.Name, "file", lp.FilePath, "error", lp.Error)
 			continue
 		}
 
@@ -332,13 +703,20 @@ func (s *SyncCmd) generateUnits(ctx context.Context, globals *Globals, repo repo
 
 		skippedSecrets, secretsErr := compose.FilterServicesWithMissingSecrets(ctx, lp.Project, nil)
 		if secretsErr != nil {
-			fmt.Printf("  WARNING: failed to query podman secrets: %v\n", secretsErr)
+			slog.Warn("failed to query podman secrets", "repo", repo.Name, "project", lp.Project.Name, "error", secretsErr)
 		}
 		for _, ms := range skippedSecrets {
-			fmt.Printf("  WARNING: skipping service %s-%s: missing secrets %v\n",
-				lp.Project.Name, ms.ServiceName, ms.MissingSecrets)
+			slog.Warn("skipping service with missing secrets",
+				"repo", repo.Name, "project", lp.Project.Name, "service", ms.ServiceName, "secrets", ms.MissingSecrets)
+			gen.skipped = append(gen.skipped, skippedService{
+				Project:        lp.Project.Name,
+				Service:        ms.ServiceName,
+				MissingSecrets: ms.MissingSecrets,
+			})
 		}
 
+		pinImages(lp.Project, digests)
+
 		units, err := systemd.Convert(lp.Project, systemd.RepositoryMeta{
 			Name:       repo.Name,
 			URL:        repo.URL,
@@ -346,23 +724,33 @@ func (s *SyncCmd) generateUnits(ctx context.Context, globals *Globals, repo repo
 			ComposeDir: repo.ComposeDir,
 		})
 		if err != nil {
-			fmt.Printf("  WARNING: failed to convert %s: %v\n", lp.FilePath, err)
+			slog.Warn("failed to convert compose project", "repo", repo.Name, "project", lp.Project.Name, "file", lp.FilePath, "error", err)
 			continue
 		}
 
-		if err := systemd.WriteUnits(units, quadletDir); err != nil {
-			return unitNames, nil, nil, fmt.Errorf("failed to write units for %s: %w", lp.FilePath, err)
+		if s.DryRun {
+			added, changed, err := systemd.CompareUnits(units, quadletDir)
+			if err != nil {
+				return gen, fmt.Errorf("failed to compare units for %s: %w", lp.FilePath, err)
+			}
+			gen.added = append(gen.added, added...)
+			gen.changed = append(gen.changed, changed...)
+		} else {
+			pending = append(pending, units...)
 		}
 
 		for _, u := range units {
-			unitNames = append(unitNames, u.Name)
+			gen.names = append(gen.names, u.Name)
+			if kind, name := u.ResourceName(); kind != "" {
+				gen.resources = append(gen.resources, resourceID{Kind: kind, Name: name})
+			}
 
 			if strings.HasSuffix(u.Name, ".container") {
 				svcName := strings.TrimPrefix(u.Name, lp.Project.Name+"-")
 				svcName = strings.TrimSuffix(svcName, ".container")
 				if svc, ok := lp.Project.Services[svcName]; ok {
 					us := systemd.ComputeUnitState(u, &svc, lp.Project.WorkingDir, repoPath)
-					unitStates[u.Name] = us
+					gen.unitStates[u.Name] = us
 				}
 			}
 		}
@@ -373,52 +761,167 @@ func (s *SyncCmd) generateUnits(ctx context.Context, globals *Globals, repo repo
 			}
 		}
 
-		if globals.Verbose {
-			fmt.Printf("  Generated %d unit(s) from %s", len(units), filepath.Base(lp.FilePath))
-			if len(skippedSecrets) > 0 {
-				fmt.Printf(" (skipped %d service(s) with missing secrets)", len(skippedSecrets))
-			}
-			fmt.Println()
+		slog.Info("generated units", "repo", repo.Name, "project", lp.Project.Name,
+			"file", filepath.Base(lp.FilePath), "units", len(units), "skipped_services", len(skippedSecrets))
+	}
+
+	if !s.DryRun {
+		if err := systemd.WriteUnits(pending, quadletDir); err != nil {
+			return &generatedUnits{}, fmt.Errorf("failed to write units: %w", err)
 		}
 	}
 
-	images := make([]string, 0, len(imageSet))
+	gen.images = make([]string, 0, len(imageSet))
 	for img := range imageSet {
-		images = append(images, img)
+		gen.images = append(gen.images, img)
 	}
 
-	return unitNames, images, unitStates, nil
+	return gen, nil
 }
 
-// cleanupStaleUnits stops, disables, and removes quadlet unit files
-// that are no longer defined by any compose project, and cleans up
-// their stored unit states.
-func (s *SyncCmd) cleanupStaleUnits(ctx context.Context, globals *Globals, deployState *state.State, client systemd.Client, staleUnits []string) {
+// pinImages rewrites service images that have a digest in digests to
+// reference that digest instead of a tag.
+func pinImages(project *types.Project, digests map[string]string) {
+	for name, svc := range project.Services {
+		if digest, ok := digests[svc.Image]; ok {
+			svc.Image = podman.PinDigest(svc.Image, digest)
+			project.Services[name] = svc
+		}
+	}
+}
+
+// result converts generated units into a per-repository result. In dry-run
+// mode only the units that would be added or changed count as written.
+func (g *generatedUnits) result(dryRun bool) *repoResult {
+	units := g.names
+	if dryRun {
+		units = slices.Concat(g.added, g.changed)
+	}
+	return &repoResult{
+		units:        units,
+		skipped:      g.skipped,
+		services:     containerServices(g.names),
+		images:       g.images,
+		unitStates:   g.unitStates,
+		unitsAdded:   g.added,
+		unitsChanged: g.changed,
+		resources:    g.resources,
+	}
+}
+
+// cleanupStaleUnits handles quadlet unit files that are no longer defined
+// by any compose project according to the onRemove policy of the repository
+// that owned them. Units to delete have their services stopped and
+// disabled, their files removed, and their stored unit states cleaned up.
+// If resource cleanup is enabled, the volumes and networks they created are
+// removed unless a managed unit or a unit in rendered still creates them.
+// Units to stop have their services stopped and lose their [Install]
+// section so they are not started at boot. Units to stop or keep stay
+// managed. See removalPolicy for units of repositories that are no longer
+// configured. It returns the units that were removed.
+func (s *SyncCmd) cleanupStaleUnits(ctx context.Context, globals *Globals, deployState *state.State, client systemd.Client, staleUnits []string, owners map[string]string, rendered []resourceID) []string {
 	quadletDir := globals.AppCfg.GetQuadletDir()
+	var removed []string
+
+	toDelete, toStop, toKeep := splitStaleUnits(globals, deployState, staleUnits, owners)
+	for _, unit := range slices.Concat(toStop, toKeep) {
+		deployState.RetainUnits(owners[unit], unit)
+	}
+	if len(toKeep) > 0 {
+		slog.Info("keeping stale units", "units", toKeep)
+	}
 
-	servicesToStop := containerServices(staleUnits)
+	servicesToDisable := containerServices(toDelete)
+	servicesToStop := slices.Concat(containerServices(toStop), servicesToDisable)
 
-	if len(servicesToStop) > 0 {
-		if globals.Verbose {
-			fmt.Printf("Stopping %d stale service(s)...\n", len(servicesToStop))
+	// Quadlet enables generated services from their unit's [Install]
+	// section, which would start a stopped service again at the next boot.
+	for _, unit := range toStop {
+		if ok, err := systemd.RemoveInstallSection(quadletDir, unit); err != nil {
+			slog.Warn("failed to remove [Install] section of stopped unit", "unit", unit, "error", err)
+		} else if ok {
+			slog.Info("removed [Install] section of stopped unit", "unit", unit)
 		}
+	}
+
+	if len(servicesToStop) > 0 {
+		slog.Info("stopping stale services", "services", servicesToStop)
 		if err := client.Stop(ctx, servicesToStop...); err != nil {
-			fmt.Printf("  WARNING: failed to stop some stale services: %v\n", err)
+			slog.Warn("failed to stop some stale services", "error", err)
 		}
-		if err := client.Disable(ctx, servicesToStop...); err != nil {
-			fmt.Printf("  WARNING: failed to disable some stale services: %v\n", err)
+	}
+	if len(servicesToDisable) > 0 {
+		if err := client.Disable(ctx, servicesToDisable...); err != nil {
+			slog.Warn("failed to disable some stale services", "error", err)
 		}
 	}
 
-	for _, unit := range staleUnits {
+	resources := staleResources(globals, toDelete, deployState.CollectAllManagedUnits(), rendered)
+
+	for _, unit := range toDelete {
 		path := filepath.Join(quadletDir, unit)
 		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-			fmt.Printf("  WARNING: failed to remove stale unit %s: %v\n", unit, err)
-		} else if globals.Verbose {
-			fmt.Printf("  Removed stale unit: %s\n", unit)
+			slog.Warn("failed to remove stale unit", "unit", unit, "error", err)
+		} else {
+			slog.Info("removed stale unit", "unit", unit)
+			removed = append(removed, unit)
 		}
 		deployState.RemoveUnitState(unit)
 	}
+
+	removeResources(ctx, globals.AppCfg.ResourceCleanup, resources)
+
+	return removed
+}
+
+// splitStaleUnits groups stale units by the onRemove policy of the
+// repository in owners that managed them.
+func splitStaleUnits(globals *Globals, deployState *state.State, staleUnits []string, owners map[string]string) (toDelete, toStop, toKeep []string) {
+	for _, unit := range staleUnits {
+		switch removalPolicy(globals, deployState, owners[unit]) {
+		case config.RemovalKeep:
+			toKeep = append(toKeep, unit)
+		case config.RemovalStop:
+			toStop = append(toStop, unit)
+		default:
+			toDelete = append(toDelete, unit)
+		}
+	}
+	return toDelete, toStop, toKeep
+}
+
+// removalPolicy returns the onRemove policy for the units of the named
+// repository. A repository that is no longer configured keeps the policy it
+// was last synced with, and falls back to RemovalStop if none was recorded,
+// so removing or renaming it never deletes units it protected. Units
+// without an owner are deleted.
+func removalPolicy(globals *Globals, deployState *state.State, repoName string) config.RemovalPolicy {
+	policy, ok := globals.AppCfg.GetOnRemove(repoName)
+	if ok || repoName == "" {
+		return policy
+	}
+	if recorded := deployState.GetOnRemove(repoName); recorded != "" {
+		return config.RemovalPolicy(recorded)
+	}
+	return config.RemovalStop
+}
+
+// excludeServices returns the services not present in exclude, preserving order.
+func excludeServices(services, exclude []string) []string {
+	if len(exclude) == 0 {
+		return services
+	}
+	excluded := make(map[string]struct{}, len(exclude))
+	for _, svc := range exclude {
+		excluded[svc] = struct{}{}
+	}
+	var remaining []string
+	for _, svc := range services {
+		if _, ok := excluded[svc]; !ok {
+			remaining = append(remaining, svc)
+		}
+	}
+	return remaining
 }
 
 // containerServices returns the systemd service names for any .container
@@ -2,11 +2,21 @@ package main
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	gosync "sync"
 	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"gopkg.in/yaml.v3"
 
 	"github.com/trly/quad-ops/internal/config"
+	"github.com/trly/quad-ops/internal/git"
 	"github.com/trly/quad-ops/internal/state"
 	"github.com/trly/quad-ops/internal/systemd"
 )
@@ -22,7 +32,11 @@ func (noopClient) Reload(context.Context, ...string) error  { return nil }
 func (noopClient) DaemonReload(context.Context) error       { return nil }
 func (noopClient) Enable(context.Context, ...string) error  { return nil }
 func (noopClient) Disable(context.Context, ...string) error { return nil }
-func (noopClient) Close() error                             { return nil }
+func (noopClient) Status(context.Context, ...string) ([]systemd.UnitStatus, error) {
+	return nil, nil
+}
+func (noopClient) Connected() bool { return true }
+func (noopClient) Close() error    { return nil }
 
 var _ systemd.Client = noopClient{}
 
@@ -42,12 +56,7 @@ func TestRunWithNoRepositories(t *testing.T) {
 	sync := &SyncCmd{}
 	globals := &Globals{
 		AppCfg: &config.AppConfig{
-			Repositories: []struct {
-				Name       string `yaml:"name"`
-				URL        string `yaml:"url"`
-				Ref        string `yaml:"ref,omitempty"`
-				ComposeDir string `yaml:"composeDir,omitempty"`
-			}{},
+			Repositories: []config.RepositoryConfig{},
 		},
 	}
 
@@ -91,7 +100,7 @@ func TestCleanupStaleUnitsRemovesFiles(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	sync.cleanupStaleUnits(ctx, globals, deployState, noopClient{}, staleFiles)
+	sync.cleanupStaleUnits(ctx, globals, deployState, noopClient{}, staleFiles, nil, nil)
 
 	// Verify unit state was cleaned up for stale container
 	_, ok := deployState.GetUnitState("app-old.container")
@@ -112,3 +121,314 @@ func TestCleanupStaleUnitsRemovesFiles(t *testing.T) {
 		t.Error("expected keep file to still exist")
 	}
 }
+
+// recordingClient is a systemd.Client that records the services it was
+// asked to stop and disable.
+type recordingClient struct {
+	noopClient
+	stopped, disabled *[]string
+}
+
+func (c recordingClient) Stop(_ context.Context, services ...string) error {
+	*c.stopped = append(*c.stopped, services...)
+	return nil
+}
+
+func (c recordingClient) Disable(_ context.Context, services ...string) error {
+	*c.disabled = append(*c.disabled, services...)
+	return nil
+}
+
+// TestCleanupStaleUnitsHonorsOnRemove tests that stale units are kept,
+// stopped, or deleted according to their repository's onRemove policy, and
+// that units of a repository removed from the configuration keep its
+// recorded policy or are stopped.
+func TestCleanupStaleUnitsHonorsOnRemove(t *testing.T) {
+	quadletDir := t.TempDir()
+	staleFiles := []string{"keep-web.container", "stop-web.container", "del-web.container", "gone-web.container", "old-web.container", "orphan-web.container"}
+	for _, name := range staleFiles {
+		if err := os.WriteFile(filepath.Join(quadletDir, name), []byte("[Container]\n[Install]\nWantedBy=default.target\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var cfg config.AppConfig
+	cfgYAML := "quadletDir: " + quadletDir + `
+repositories:
+  - name: keep
+    onRemove: keep
+  - name: stop
+    onRemove: stop
+  - name: del
+`
+	if err := yaml.Unmarshal([]byte(cfgYAML), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	globals := &Globals{AppCfg: &cfg}
+
+	owners := map[string]string{
+		"keep-web.container": "keep",
+		"stop-web.container": "stop",
+		"del-web.container":  "del",
+		"gone-web.container": "gone",
+		"old-web.container":  "old",
+	}
+	// "old" and "gone" were removed from the configuration; only "old"
+	// recorded its policy when it was last synced.
+	deployState := &state.State{Repositories: map[string]state.RepoState{
+		"old":  {OnRemove: "keep"},
+		"gone": {},
+	}}
+
+	var stopped, disabled []string
+	client := recordingClient{stopped: &stopped, disabled: &disabled}
+	removed := (&SyncCmd{}).cleanupStaleUnits(context.Background(), globals, deployState, client, staleFiles, owners, nil)
+
+	slices.Sort(removed)
+	if want := []string{"del-web.container", "orphan-web.container"}; !slices.Equal(removed, want) {
+		t.Errorf("expected removed %v, got %v", want, removed)
+	}
+	slices.Sort(stopped)
+	if want := []string{"del-web.service", "gone-web.service", "orphan-web.service", "stop-web.service"}; !slices.Equal(stopped, want) {
+		t.Errorf("expected stopped %v, got %v", want, stopped)
+	}
+	slices.Sort(disabled)
+	if want := []string{"del-web.service", "orphan-web.service"}; !slices.Equal(disabled, want) {
+		t.Errorf("expected only deleted units to be disabled, got %v", disabled)
+	}
+
+	for _, name := range []string{"keep-web.container", "stop-web.container", "gone-web.container", "old-web.container"} {
+		if _, err := os.Stat(filepath.Join(quadletDir, name)); err != nil {
+			t.Errorf("expected %s to be kept: %v", name, err)
+		}
+	}
+	if content, _ := os.ReadFile(filepath.Join(quadletDir, "stop-web.container")); strings.Contains(string(content), "[Install]") {
+		t.Errorf("expected stopped unit to lose its [Install] section, got %q", content)
+	}
+	if content, _ := os.ReadFile(filepath.Join(quadletDir, "keep-web.container")); !strings.Contains(string(content), "[Install]") {
+		t.Errorf("expected kept unit to stay enabled, got %q", content)
+	}
+	if got := deployState.GetManagedUnits("keep"); !slices.Equal(got, []string{"keep-web.container"}) {
+		t.Errorf("expected kept unit to stay managed, got %v", got)
+	}
+	if got := deployState.GetManagedUnits("stop"); !slices.Equal(got, []string{"stop-web.container"}) {
+		t.Errorf("expected stopped unit to stay managed, got %v", got)
+	}
+	if content, _ := os.ReadFile(filepath.Join(quadletDir, "old-web.container")); !strings.Contains(string(content), "[Install]") {
+		t.Errorf("expected unit of removed repository with keep to stay enabled, got %q", content)
+	}
+	if got := deployState.GetManagedUnits("old"); !slices.Equal(got, []string{"old-web.container"}) {
+		t.Errorf("expected unit of removed repository with keep to stay managed, got %v", got)
+	}
+}
+
+// TestGenerateUnitsDryRunDoesNotWrite tests that dry-run renders units and
+// reports them as added without creating files in the quadlet directory.
+func TestGenerateUnitsDryRunDoesNotWrite(t *testing.T) {
+	repoPath := t.TempDir()
+	quadletDir := t.TempDir()
+
+	projectDir := filepath.Join(repoPath, "app")
+	if err := os.MkdirAll(projectDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	compose := "services:\n  web:\n    image: docker.io/library/nginx:latest\n"
+	if err := os.WriteFile(filepath.Join(projectDir, "compose.yaml"), []byte(compose), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sync := &SyncCmd{DryRun: true}
+	globals := &Globals{AppCfg: &config.AppConfig{QuadletDir: quadletDir}}
+
+	gen, err := sync.generateUnits(context.Background(), globals, repoConfig{Name: "repo"}, repoPath, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !slices.Contains(gen.names, "app-web.container") {
+		t.Fatalf("expected app-web.container to be generated, got %v", gen.names)
+	}
+	if !slices.Equal(gen.added, gen.names) {
+		t.Errorf("expected all generated units to be reported as added, got %v", gen.added)
+	}
+	if len(gen.changed) != 0 {
+		t.Errorf("expected no changed units, got %v", gen.changed)
+	}
+
+	entries, err := os.ReadDir(quadletDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected quadlet directory to stay empty, found %d file(s)", len(entries))
+	}
+}
+
+// TestRestoreCheckout tests that the clone a dry run checked out to render
+// a new commit is returned to the deployed commit.
+func TestRestoreCheckout(t *testing.T) {
+	remoteDir := filepath.Join(t.TempDir(), "remote")
+	remote, err := gogit.PlainInit(remoteDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := remote.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(content string) string {
+		if err := os.WriteFile(filepath.Join(remoteDir, "compose.yaml"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := worktree.Add("compose.yaml"); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := worktree.Commit(content, &gogit.CommitOptions{
+			Author: &object.Signature{Name: "Test User", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash.String()
+	}
+	deployed := commit("deployed")
+	commit("pending")
+
+	rc := repoConfig{Name: "repo", URL: remoteDir}
+	repoPath := filepath.Join(t.TempDir(), "repo")
+	if err := git.New(rc.Name, rc.URL, "", "", repoPath).Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	restoreCheckout(rc, repoPath, deployed)
+
+	content, err := os.ReadFile(filepath.Join(repoPath, "compose.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "deployed" {
+		t.Errorf("expected the deployed commit to be checked out, got %q", content)
+	}
+}
+
+// TestGenerateUnitsPinsDigests tests that images with a recorded digest are
+// written to container units by digest rather than by tag.
+func TestGenerateUnitsPinsDigests(t *testing.T) {
+	repoPath := t.TempDir()
+	quadletDir := t.TempDir()
+
+	projectDir := filepath.Join(repoPath, "app")
+	if err := os.MkdirAll(projectDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	compose := "services:\n  web:\n    image: docker.io/library/nginx:latest\n  cache:\n    image: docker.io/library/redis:7\n"
+	if err := os.WriteFile(filepath.Join(projectDir, "compose.yaml"), []byte(compose), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sync := &SyncCmd{}
+	globals := &Globals{AppCfg: &config.AppConfig{QuadletDir: quadletDir}}
+	digests := map[string]string{"docker.io/library/nginx:latest": "sha256:0123abcd"}
+
+	gen, err := sync.generateUnits(context.Background(), globals, repoConfig{Name: "repo"}, repoPath, digests)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	web, err := os.ReadFile(filepath.Join(quadletDir, "app-web.container"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(web), "docker.io/library/nginx@sha256:0123abcd\n") {
+		t.Errorf("expected pinned image in unit, got:\n%s", web)
+	}
+
+	cache, err := os.ReadFile(filepath.Join(quadletDir, "app-cache.container"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(cache), "docker.io/library/redis:7\n") {
+		t.Errorf("expected unpinned image without a recorded digest, got:\n%s", cache)
+	}
+
+	if !slices.Contains(gen.images, "docker.io/library/nginx@sha256:0123abcd") {
+		t.Errorf("expected pinned image to be pulled, got %v", gen.images)
+	}
+}
+
+// TestExcludeServices tests that excluded services are filtered out in order.
+func TestExcludeServices(t *testing.T) {
+	got := excludeServices([]string{"a.service", "b.service", "c.service"}, []string{"b.service"})
+	want := []string{"a.service", "c.service"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+// TestCheckRepoNames tests that --repo rejects names that are neither
+// configured nor recorded in state.
+func TestCheckRepoNames(t *testing.T) {
+	cfg := &config.AppConfig{}
+	if err := yaml.Unmarshal([]byte("repositories:\n  - name: infra\n    url: https://example.com/infra.git\n"), cfg); err != nil {
+		t.Fatal(err)
+	}
+	sync := &SyncCmd{}
+	globals := &Globals{AppCfg: cfg}
+
+	if err := sync.checkRepoNames(globals, []string{"infra"}); err != nil {
+		t.Errorf("expected configured repository to be accepted, got %v", err)
+	}
+	if err := sync.checkRepoNames(globals, nil); err != nil {
+		t.Errorf("expected no error without --repo, got %v", err)
+	}
+
+	err := sync.checkRepoNames(globals, []string{"infra", "typo-repo"})
+	if err == nil || !strings.Contains(err.Error(), `unknown repository "typo-repo"`) {
+		t.Errorf("expected unknown repository error, got %v", err)
+	}
+}
+
+// TestProcessReposBoundedAndOrdered tests that repositories are processed
+// concurrently up to the worker limit and results keep configuration order.
+func TestProcessReposBoundedAndOrdered(t *testing.T) {
+	repos := []repoConfig{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}}
+
+	var mu gosync.Mutex
+	running, peak := 0, 0
+	results, errs := processRepos(repos, 2, func(rc repoConfig) (*repoResult, error) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		if rc.Name == "c" {
+			return nil, errors.New("boom")
+		}
+		return &repoResult{services: []string{rc.Name + ".service"}}, nil
+	})
+
+	if peak > 2 {
+		t.Errorf("expected at most 2 concurrent workers, saw %d", peak)
+	}
+	for i, rc := range repos {
+		if rc.Name == "c" {
+			if errs[i] == nil || results[i] != nil {
+				t.Errorf("expected error for %s", rc.Name)
+			}
+			continue
+		}
+		if errs[i] != nil {
+			t.Errorf("unexpected error for %s: %v", rc.Name, errs[i])
+			continue
+		}
+		if got := results[i].services[0]; got != rc.Name+".service" {
+			t.Errorf("result %d: expected %s.service, got %s", i, rc.Name, got)
+		}
+	}
+}
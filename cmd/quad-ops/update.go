@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"fmt"
 
 	"github.com/creativeprojects/go-selfupdate"
@@ -12,7 +11,7 @@ import (
 type UpdateCmd struct{}
 
 // Run executes the update command.
-func (u *UpdateCmd) Run() error {
+func (u *UpdateCmd) Run(globals *Globals) error {
 	fmt.Printf("Current version: %s\n", buildinfo.Version)
 
 	if buildinfo.IsDev() {
@@ -22,7 +21,7 @@ func (u *UpdateCmd) Run() error {
 
 	fmt.Println("Checking for updates...")
 
-	status, err := buildinfo.CheckForUpdates(context.Background())
+	status, err := buildinfo.CheckForUpdates(globals.Context())
 	if err != nil {
 		return err
 	}
@@ -42,7 +41,7 @@ func (u *UpdateCmd) Run() error {
 	}
 
 	// Update to the latest version
-	if err := selfupdate.UpdateTo(context.Background(), status.AssetURL, status.AssetName, exe); err != nil {
+	if err := selfupdate.UpdateTo(globals.Context(), status.AssetURL, status.AssetName, exe); err != nil {
 		return fmt.Errorf("failed to update: %w", err)
 	}
 
@@ -12,7 +12,7 @@ import (
 func TestUpdateCmd_Basic(t *testing.T) {
 	output, err := captureOutput(func() error {
 		cmd := &UpdateCmd{}
-		return cmd.Run()
+		return cmd.Run(&Globals{})
 	})
 
 	require.NoError(t, err)
@@ -28,7 +28,7 @@ func TestUpdateCmd_CurrentVersionDisplay(t *testing.T) {
 
 	output, err := captureOutput(func() error {
 		cmd := &UpdateCmd{}
-		return cmd.Run()
+		return cmd.Run(&Globals{})
 	})
 
 	require.NoError(t, err)
@@ -44,7 +44,7 @@ func TestUpdateCmd_CheckUpdates(t *testing.T) {
 
 	output, err := captureOutput(func() error {
 		cmd := &UpdateCmd{}
-		return cmd.Run()
+		return cmd.Run(&Globals{})
 	})
 
 	require.NoError(t, err)
@@ -64,7 +64,7 @@ func TestUpdateCmd_UsesVersionVar(t *testing.T) {
 
 	cmd := &UpdateCmd{}
 	// Execute - will fail on network, but shouldn't panic
-	_ = cmd.Run()
+	_ = cmd.Run(&Globals{})
 }
 
 // TestUpdateCmd_DevVersionSkipsUpdate tests that dev version skips update check.
@@ -76,7 +76,7 @@ func TestUpdateCmd_DevVersionSkipsUpdate(t *testing.T) {
 
 	output, err := captureOutput(func() error {
 		cmd := &UpdateCmd{}
-		return cmd.Run()
+		return cmd.Run(&Globals{})
 	})
 
 	require.NoError(t, err)
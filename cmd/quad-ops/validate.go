@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 
@@ -18,11 +19,11 @@ type ValidateCmd struct {
 func (v *ValidateCmd) checkSecrets(ctx context.Context, project *types.Project, filePath string) {
 	missingSecrets, err := compose.CheckMissingSecrets(ctx, project)
 	if err != nil {
-		fmt.Printf("WARNING: %s: failed to check secrets: %v\n", filePath, err)
+		slog.Warn("failed to check secrets", "file", filePath, "error", err)
 	}
 	for _, ms := range missingSecrets {
-		fmt.Printf("WARNING: %s: service %q requires missing secrets: %v\n",
-			filePath, ms.ServiceName, ms.MissingSecrets)
+		slog.Warn("service requires missing secrets",
+			"file", filePath, "project", project.Name, "service", ms.ServiceName, "secrets", ms.MissingSecrets)
 	}
 }
 
@@ -45,7 +46,7 @@ func (v *ValidateCmd) processLoadedProject(ctx context.Context, lp compose.Loade
 }
 
 func (v *ValidateCmd) Run(globals *Globals) error {
-	ctx := context.Background()
+	ctx := globals.Context()
 	var failures int
 
 	// If -p flag was explicitly provided, only validate the specified path
@@ -73,8 +74,8 @@ func (v *ValidateCmd) Run(globals *Globals) error {
 		// Validate repositories from configuration if available and no path specified
 		if globals.AppCfg != nil && len(globals.AppCfg.Repositories) > 0 {
 			repoFailures, err := v.validateRepositories(ctx, globals)
-			if err != nil && globals.Verbose {
-				fmt.Printf("WARNING: failed to validate repositories: %v\n", err)
+			if err != nil {
+				slog.Info("failed to validate repositories", "error", err)
 			}
 			failures += repoFailures
 		}
@@ -103,16 +104,12 @@ func (v *ValidateCmd) validateRepositories(ctx context.Context, globals *Globals
 		// Load all compose projects recursively
 		projects, err := compose.LoadAll(ctx, scanPath, nil)
 		if err != nil {
-			if globals.Verbose {
-				fmt.Printf("WARNING: %s: failed to scan: %v\n", repo.Name, err)
-			}
+			slog.Info("skipping repository that could not be scanned", "repo", repo.Name, "error", err)
 			continue
 		}
 
 		if len(projects) == 0 {
-			if globals.Verbose {
-				fmt.Printf("WARNING: %s: no compose files found\n", repo.Name)
-			}
+			slog.Info("no compose files found", "repo", repo.Name)
 			continue
 		}
 
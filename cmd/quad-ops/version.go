@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"fmt"
 
 	"github.com/trly/quad-ops/internal/buildinfo"
@@ -9,7 +8,7 @@ import (
 
 type VersionCmd struct{}
 
-func (v *VersionCmd) Run() error {
+func (v *VersionCmd) Run(globals *Globals) error {
 	fmt.Printf("quad-ops version %s\n", buildinfo.Version)
 	fmt.Printf("  commit: %s\n", buildinfo.Commit)
 	fmt.Printf("  built: %s\n", buildinfo.Date)
@@ -22,7 +21,7 @@ func (v *VersionCmd) Run() error {
 
 	fmt.Println("\nChecking for updates...")
 
-	status, err := buildinfo.CheckForUpdates(context.Background())
+	status, err := buildinfo.CheckForUpdates(globals.Context())
 	if err != nil {
 		fmt.Printf("Failed to check for updates: %v\n", err)
 		return nil
@@ -40,7 +40,7 @@ func captureOutput(fn func() error) (string, error) {
 func TestVersionCommand_OutputContainsVersionInfo(t *testing.T) {
 	output, err := captureOutput(func() error {
 		cmd := &VersionCmd{}
-		return cmd.Run()
+		return cmd.Run(&Globals{})
 	})
 
 	require.NoError(t, err)
@@ -59,7 +59,7 @@ func TestVersionCommand_DevVersion(t *testing.T) {
 
 	output, err := captureOutput(func() error {
 		cmd := &VersionCmd{}
-		return cmd.Run()
+		return cmd.Run(&Globals{})
 	})
 
 	require.NoError(t, err)
@@ -76,7 +76,7 @@ func TestVersionCommand_ReleaseVersion(t *testing.T) {
 
 	output, err := captureOutput(func() error {
 		cmd := &VersionCmd{}
-		return cmd.Run()
+		return cmd.Run(&Globals{})
 	})
 
 	require.NoError(t, err)
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/trly/quad-ops/internal/config"
+	"github.com/trly/quad-ops/internal/webhook"
+)
+
+// maxWebhookBody caps the size of accepted webhook payloads (GitHub's limit).
+const maxWebhookBody = 25 << 20
+
+// syncTrigger collects repository names requested by webhooks until the
+// daemon loop is ready to sync them. Requests arriving while a sync is in
+// progress are coalesced into the next run.
+type syncTrigger struct {
+	mu      sync.Mutex
+	pending map[string]struct{}
+	notify  chan struct{}
+}
+
+func newSyncTrigger() *syncTrigger {
+	return &syncTrigger{
+		pending: make(map[string]struct{}),
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// add queues the named repositories and wakes the daemon loop.
+func (t *syncTrigger) add(names ...string) {
+	t.mu.Lock()
+	for _, name := range names {
+		t.pending[name] = struct{}{}
+	}
+	t.mu.Unlock()
+
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take returns and clears the queued repository names in sorted order.
+func (t *syncTrigger) take() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	names := make([]string, 0, len(t.pending))
+	for name := range t.pending {
+		names = append(names, name)
+	}
+	clear(t.pending)
+	slices.Sort(names)
+	return names
+}
+
+// webhookHandler verifies push webhooks and queues syncs for the configured
+// repositories whose URL and ref match the push.
+type webhookHandler struct {
+	cfg     atomic.Pointer[config.AppConfig]
+	trigger *syncTrigger
+}
+
+func newWebhookHandler(cfg *config.AppConfig, trigger *syncTrigger) *webhookHandler {
+	h := &webhookHandler{trigger: trigger}
+	h.cfg.Store(cfg)
+	return h
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody+1))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxWebhookBody {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	cfg := h.cfg.Load()
+	secret, err := cfg.Webhook.GetSecret()
+	if err != nil {
+		slog.Error("failed to read webhook secret", "error", err)
+		http.Error(w, "webhook secret unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	event, err := webhook.Parse(r.Header, body, secret)
+	switch {
+	case errors.Is(err, webhook.ErrIgnoredEvent):
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintln(w, "ignored")
+		return
+	case errors.Is(err, webhook.ErrInvalidSignature):
+		slog.Warn("rejected webhook", "remote", r.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var names []string
+	for _, repo := range cfg.Repositories {
+		if event.Matches(repo.URL, repo.Ref) {
+			names = append(names, repo.Name)
+		}
+	}
+
+	if len(names) == 0 {
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintln(w, "no matching repositories")
+		return
+	}
+
+	slog.Info("queued sync from webhook", "provider", string(event.Provider), "ref", event.Ref, "repos", names)
+	h.trigger.add(names...)
+
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = fmt.Fprintf(w, "queued sync of %s\n", strings.Join(names, ", "))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/trly/quad-ops/internal/config"
+)
+
+const webhookTestConfig = `
+repositories:
+  - name: infra
+    url: git@github.com:example/infra.git
+    ref: main
+  - name: infra-staging
+    url: https://github.com/example/infra.git
+    ref: staging
+  - name: other
+    url: https://github.com/example/other.git
+webhook:
+  secret: s3cr3t
+`
+
+func newTestWebhookServer(t *testing.T) (*httptest.Server, *syncTrigger) {
+	t.Helper()
+	cfg := &config.AppConfig{}
+	require.NoError(t, yaml.Unmarshal([]byte(webhookTestConfig), cfg))
+
+	trigger := newSyncTrigger()
+	srv := httptest.NewServer(newWebhookHandler(cfg, trigger))
+	t.Cleanup(srv.Close)
+	return srv, trigger
+}
+
+func postGitHubPush(t *testing.T, url, secret string) *http.Response {
+	t.Helper()
+	body, err := os.ReadFile("../../internal/webhook/testdata/github_push.json")
+	require.NoError(t, err)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+// TestWebhookQueuesMatchingRepository tests that a signed push queues only
+// the repository whose URL and ref match.
+func TestWebhookQueuesMatchingRepository(t *testing.T) {
+	srv, trigger := newTestWebhookServer(t)
+
+	resp := postGitHubPush(t, srv.URL, "s3cr3t")
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	select {
+	case <-trigger.notify:
+	default:
+		t.Fatal("expected sync trigger to be notified")
+	}
+	assert.Equal(t, []string{"infra"}, trigger.take())
+}
+
+// TestWebhookRejectsBadSignature tests that unsigned pushes queue nothing.
+func TestWebhookRejectsBadSignature(t *testing.T) {
+	srv, trigger := newTestWebhookServer(t)
+
+	resp := postGitHubPush(t, srv.URL, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Empty(t, trigger.take())
+}
+
+// TestWebhookRejectsGet tests that only POST is accepted.
+func TestWebhookRejectsGet(t *testing.T) {
+	srv, _ := newTestWebhookServer(t)
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+// TestSyncTriggerCoalesces tests that repeated requests collapse into one run.
+func TestSyncTriggerCoalesces(t *testing.T) {
+	trigger := newSyncTrigger()
+	trigger.add("b")
+	trigger.add("a", "b")
+
+	assert.Len(t, trigger.notify, 1)
+	assert.Equal(t, []string{"a", "b"}, trigger.take())
+	assert.Empty(t, trigger.take())
+}
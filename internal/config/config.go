@@ -2,8 +2,13 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // getuid is the function used to retrieve the current user ID.
@@ -12,14 +17,206 @@ var getuid = os.Getuid
 
 // AppConfig represents the application configuration loaded from a YAML file.
 type AppConfig struct {
-	RepositoryDir string `yaml:"repositoryDir,omitempty"`
-	QuadletDir    string `yaml:"quadletDir,omitempty"`
-	Repositories  []struct {
-		Name       string `yaml:"name"`
-		URL        string `yaml:"url"`
-		Ref        string `yaml:"ref,omitempty"`
-		ComposeDir string `yaml:"composeDir,omitempty"`
-	} `yaml:"repositories"`
+	RepositoryDir   string                `yaml:"repositoryDir,omitempty"`
+	QuadletDir      string                `yaml:"quadletDir,omitempty"`
+	Parallelism     int                   `yaml:"parallelism,omitempty"`
+	Repositories    []RepositoryConfig    `yaml:"repositories"`
+	Webhook         WebhookConfig         `yaml:"webhook,omitempty"`
+	AutoRollback    AutoRollbackConfig    `yaml:"autoRollback,omitempty"`
+	ResourceCleanup ResourceCleanupConfig `yaml:"resourceCleanup,omitempty"`
+}
+
+// RepositoryConfig describes a git repository to deploy compose projects from.
+type RepositoryConfig struct {
+	Name       string        `yaml:"name"`
+	URL        string        `yaml:"url"`
+	Ref        string        `yaml:"ref,omitempty"`
+	ComposeDir string        `yaml:"composeDir,omitempty"`
+	OnRemove   RemovalPolicy `yaml:"onRemove,omitempty"`
+	Auth       GitAuthConfig `yaml:"auth,omitempty"`
+	// Depth limits fetches to this many commits from each ref tip; 0
+	// fetches the full history.
+	Depth int `yaml:"depth,omitempty"`
+	// Sparse checks out only ComposeDir instead of the whole tree.
+	Sparse bool `yaml:"sparse,omitempty"`
+	// FetchTimeout bounds how long cloning or fetching may take; see
+	// GetFetchTimeout.
+	FetchTimeout time.Duration `yaml:"fetchTimeout,omitempty"`
+	Verify       VerifyConfig  `yaml:"verify,omitempty"`
+}
+
+// VerifyConfig requires commits to be signed before they are deployed.
+type VerifyConfig struct {
+	// Keys lists files containing trusted signing keys: armored OpenPGP
+	// public keys, or SSH public keys in authorized_keys or allowed_signers
+	// format. Verification is enabled when at least one is listed.
+	Keys []string `yaml:"keys,omitempty"`
+}
+
+// Enabled reports whether signatures must be verified.
+func (v VerifyConfig) Enabled() bool {
+	return len(v.Keys) > 0
+}
+
+// defaultFetchTimeout is how long a clone or fetch may take when
+// RepositoryConfig.FetchTimeout is not configured.
+const defaultFetchTimeout = 5 * time.Minute
+
+// GetFetchTimeout returns how long a clone or fetch may take, using the
+// default if not configured. A negative FetchTimeout disables the limit and
+// returns 0, leaving fetches bounded only by the run being interrupted.
+func (r RepositoryConfig) GetFetchTimeout() time.Duration {
+	switch {
+	case r.FetchTimeout < 0:
+		return 0
+	case r.FetchTimeout > 0:
+		return r.FetchTimeout
+	}
+	return defaultFetchTimeout
+}
+
+// GitAuthConfig holds the credentials used to fetch a repository. Secrets
+// are read from a file or an environment variable so they stay out of the
+// configuration file.
+type GitAuthConfig struct {
+	// SSHKeyFile is a private key used for SSH URLs.
+	SSHKeyFile           string `yaml:"sshKeyFile,omitempty"`
+	SSHKeyPassphraseFile string `yaml:"sshKeyPassphraseFile,omitempty"`
+	// SSHAgent authenticates SSH URLs with the keys held by the SSH agent.
+	SSHAgent bool `yaml:"sshAgent,omitempty"`
+	// KnownHostsFile replaces the default known_hosts files.
+	KnownHostsFile string `yaml:"knownHostsFile,omitempty"`
+	// HostKeyPolicy is strict (the default), accept-new, or off.
+	HostKeyPolicy string `yaml:"hostKeyPolicy,omitempty"`
+	// Username, and a password or access token, for HTTPS URLs.
+	Username     string `yaml:"username,omitempty"`
+	PasswordFile string `yaml:"passwordFile,omitempty"`
+	PasswordEnv  string `yaml:"passwordEnv,omitempty"`
+}
+
+// GetPassword returns the HTTPS password or token, read from PasswordFile
+// or the PasswordEnv environment variable.
+func (a GitAuthConfig) GetPassword() (string, error) {
+	if a.PasswordFile != "" {
+		return readSecretFile(a.PasswordFile, "password")
+	}
+	if a.PasswordEnv != "" {
+		password, ok := os.LookupEnv(a.PasswordEnv)
+		if !ok {
+			return "", fmt.Errorf("password environment variable %s is not set", a.PasswordEnv)
+		}
+		return password, nil
+	}
+	return "", nil
+}
+
+// GetSSHKeyPassphrase returns the SSH key passphrase, read from
+// SSHKeyPassphraseFile.
+func (a GitAuthConfig) GetSSHKeyPassphrase() (string, error) {
+	if a.SSHKeyPassphraseFile == "" {
+		return "", nil
+	}
+	return readSecretFile(a.SSHKeyPassphraseFile, "SSH key passphrase")
+}
+
+// readSecretFile reads a secret from path, ignoring surrounding whitespace.
+func readSecretFile(path, what string) (string, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // configured path
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s file: %w", what, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// RemovalPolicy controls what a sync does with units that a repository
+// previously deployed but no longer defines.
+type RemovalPolicy string
+
+const (
+	// RemovalDelete stops and disables the units' services and deletes the
+	// unit files. It is the default.
+	RemovalDelete RemovalPolicy = "delete"
+	// RemovalStop stops the units' services but keeps the unit files.
+	RemovalStop RemovalPolicy = "stop"
+	// RemovalKeep leaves the units and their services untouched.
+	RemovalKeep RemovalPolicy = "keep"
+)
+
+// UnmarshalYAML rejects unknown removal policies.
+func (p *RemovalPolicy) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	switch policy := RemovalPolicy(s); policy {
+	case RemovalDelete, RemovalStop, RemovalKeep:
+		*p = policy
+		return nil
+	default:
+		return fmt.Errorf("invalid onRemove %q: must be keep, stop, or delete", s)
+	}
+}
+
+// GetOnRemove returns the removal policy of the named repository, using
+// RemovalDelete if it is not set. ok is false if no repository with that
+// name is configured.
+func (c *AppConfig) GetOnRemove(repoName string) (policy RemovalPolicy, ok bool) {
+	for _, repo := range c.Repositories {
+		if repo.Name == repoName {
+			if repo.OnRemove == "" {
+				return RemovalDelete, true
+			}
+			return repo.OnRemove, true
+		}
+	}
+	return RemovalDelete, false
+}
+
+// ResourceCleanupConfig controls whether deleting a stale .volume or
+// .network unit also removes the Podman volume or network it created.
+type ResourceCleanupConfig struct {
+	Networks bool `yaml:"networks"`
+	Volumes  bool `yaml:"volumes"`
+	// VolumeBackupDir receives a tar export of every volume that contains
+	// data before it is removed. Without it, volumes that contain data are
+	// kept and only empty volumes are removed.
+	VolumeBackupDir string `yaml:"volumeBackupDir,omitempty"`
+}
+
+// AutoRollbackConfig controls whether a sync watches newly deployed
+// services and rolls a repository back if they become unhealthy.
+type AutoRollbackConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Window  time.Duration `yaml:"window,omitempty"`
+}
+
+// defaultHealthWindow is how long services are watched after a deploy when
+// AutoRollbackConfig.Window is not configured.
+const defaultHealthWindow = 2 * time.Minute
+
+// GetWindow returns how long to watch services after a deploy, using the
+// default if not configured or not positive.
+func (a AutoRollbackConfig) GetWindow() time.Duration {
+	if a.Window > 0 {
+		return a.Window
+	}
+	return defaultHealthWindow
+}
+
+// WebhookConfig holds the shared secret used to verify push webhooks
+// received in daemon mode. SecretFile takes precedence over Secret.
+type WebhookConfig struct {
+	Secret     string `yaml:"secret,omitempty"`
+	SecretFile string `yaml:"secretFile,omitempty"`
+}
+
+// GetSecret returns the webhook secret, reading it from SecretFile if set.
+// Surrounding whitespace in the file is ignored.
+func (w WebhookConfig) GetSecret() (string, error) {
+	if w.SecretFile == "" {
+		return w.Secret, nil
+	}
+	return readSecretFile(w.SecretFile, "webhook secret")
 }
 
 // IsUserMode returns true if running as non-root user (uid != 0).
@@ -48,6 +245,19 @@ func (c *AppConfig) GetStateFilePath() string {
 	return "/var/lib/quad-ops/state.json"
 }
 
+// defaultParallelism is the number of repositories processed concurrently
+// when Parallelism is not configured.
+const defaultParallelism = 4
+
+// GetParallelism returns the maximum number of repositories to process
+// concurrently, using the default if not configured or not positive.
+func (c *AppConfig) GetParallelism() int {
+	if c.Parallelism > 0 {
+		return c.Parallelism
+	}
+	return defaultParallelism
+}
+
 // GetQuadletDir returns the quadlet directory, using the default based on user mode if not configured.
 func (c *AppConfig) GetQuadletDir() string {
 	if c.QuadletDir != "" {
@@ -4,8 +4,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func fakeRoot(t *testing.T) {
@@ -72,3 +75,106 @@ func TestGetQuadletDir_DefaultSystemMode(t *testing.T) {
 	cfg := &AppConfig{}
 	assert.Equal(t, "/etc/containers/systemd", cfg.GetQuadletDir())
 }
+
+func TestGetParallelism(t *testing.T) {
+	assert.Equal(t, 4, (&AppConfig{}).GetParallelism())
+	assert.Equal(t, 4, (&AppConfig{Parallelism: -1}).GetParallelism())
+	assert.Equal(t, 1, (&AppConfig{Parallelism: 1}).GetParallelism())
+}
+
+func TestWebhookGetSecret_Inline(t *testing.T) {
+	w := WebhookConfig{Secret: "inline"}
+	secret, err := w.GetSecret()
+	assert.NoError(t, err)
+	assert.Equal(t, "inline", secret)
+}
+
+func TestWebhookGetSecret_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	assert.NoError(t, os.WriteFile(path, []byte("from-file\n"), 0o600))
+
+	w := WebhookConfig{Secret: "inline", SecretFile: path}
+	secret, err := w.GetSecret()
+	assert.NoError(t, err)
+	assert.Equal(t, "from-file", secret)
+}
+
+func TestWebhookGetSecret_MissingFile(t *testing.T) {
+	w := WebhookConfig{SecretFile: "/nonexistent/secret"}
+	_, err := w.GetSecret()
+	assert.ErrorContains(t, err, "failed to read webhook secret file")
+}
+
+func TestAutoRollbackGetWindow(t *testing.T) {
+	assert.Equal(t, 2*time.Minute, AutoRollbackConfig{}.GetWindow())
+	assert.Equal(t, 30*time.Second, AutoRollbackConfig{Window: 30 * time.Second}.GetWindow())
+}
+
+func TestAutoRollbackUnmarshal(t *testing.T) {
+	var cfg AppConfig
+	require.NoError(t, yaml.Unmarshal([]byte("autoRollback:\n  enabled: true\n  window: 90s\n"), &cfg))
+	assert.True(t, cfg.AutoRollback.Enabled)
+	assert.Equal(t, 90*time.Second, cfg.AutoRollback.Window)
+}
+
+func TestGetFetchTimeout(t *testing.T) {
+	assert.Equal(t, 5*time.Minute, RepositoryConfig{}.GetFetchTimeout())
+	assert.Equal(t, 30*time.Second, RepositoryConfig{FetchTimeout: 30 * time.Second}.GetFetchTimeout())
+	assert.Zero(t, RepositoryConfig{FetchTimeout: -time.Second}.GetFetchTimeout(), "negative disables the limit")
+
+	var cfg AppConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`repositories:
+  - name: a
+    url: https://example.com/a.git
+    fetchTimeout: -1s
+`), &cfg))
+	assert.Zero(t, cfg.Repositories[0].GetFetchTimeout())
+}
+
+func TestGetOnRemove(t *testing.T) {
+	var cfg AppConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`repositories:
+  - name: a
+    url: https://example.com/a.git
+    onRemove: keep
+  - name: b
+    url: https://example.com/b.git
+`), &cfg))
+
+	policy, ok := cfg.GetOnRemove("a")
+	assert.True(t, ok)
+	assert.Equal(t, RemovalKeep, policy)
+
+	policy, ok = cfg.GetOnRemove("b")
+	assert.True(t, ok)
+	assert.Equal(t, RemovalDelete, policy)
+
+	_, ok = cfg.GetOnRemove("unknown")
+	assert.False(t, ok)
+}
+
+func TestOnRemoveRejectsUnknownPolicy(t *testing.T) {
+	var cfg AppConfig
+	err := yaml.Unmarshal([]byte("repositories:\n  - name: a\n    onRemove: purge\n"), &cfg)
+	assert.ErrorContains(t, err, `invalid onRemove "purge"`)
+}
+
+func TestGitAuthGetPassword_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(path, []byte("ghp_token\n"), 0o600))
+
+	password, err := GitAuthConfig{PasswordFile: path, PasswordEnv: "UNUSED"}.GetPassword()
+	assert.NoError(t, err)
+	assert.Equal(t, "ghp_token", password)
+}
+
+func TestGitAuthGetPassword_Env(t *testing.T) {
+	t.Setenv("QUAD_OPS_TEST_TOKEN", "from-env")
+
+	password, err := GitAuthConfig{PasswordEnv: "QUAD_OPS_TEST_TOKEN"}.GetPassword()
+	assert.NoError(t, err)
+	assert.Equal(t, "from-env", password)
+
+	_, err = GitAuthConfig{PasswordEnv: "QUAD_OPS_TEST_UNSET"}.GetPassword()
+	assert.ErrorContains(t, err, "QUAD_OPS_TEST_UNSET is not set")
+}
@@ -0,0 +1,167 @@
+package git
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyPolicy controls how SSH host keys are verified.
+type HostKeyPolicy string
+
+const (
+	// HostKeyStrict rejects hosts whose key is not in the known hosts file.
+	HostKeyStrict HostKeyPolicy = "strict"
+	// HostKeyAcceptNew records the keys of hosts not yet in the known hosts
+	// file and rejects hosts whose recorded key changed.
+	HostKeyAcceptNew HostKeyPolicy = "accept-new"
+	// HostKeyOff accepts any host key.
+	HostKeyOff HostKeyPolicy = "off"
+)
+
+// Auth holds the credentials used to fetch a repository. The zero value
+// uses go-git's defaults: the SSH agent and the user's known_hosts files for
+// SSH URLs, and no credentials for HTTP URLs.
+type Auth struct {
+	// SSHKeyFile is a private key used for SSH URLs, decrypted with
+	// SSHKeyPassphrase if it is encrypted.
+	SSHKeyFile       string
+	SSHKeyPassphrase string
+	// SSHAgent authenticates SSH URLs with the keys held by the SSH agent.
+	SSHAgent bool
+	// KnownHostsFile replaces the default known_hosts files.
+	KnownHostsFile string
+	// HostKeyPolicy defaults to HostKeyStrict.
+	HostKeyPolicy HostKeyPolicy
+	// Username and Password are sent as HTTP basic auth. An access token is
+	// sent as the password; Username defaults to "git" and cannot be set
+	// without a Password.
+	Username string
+	Password string
+}
+
+// method returns the go-git auth method for url, or nil to use go-git's
+// defaults.
+func (a Auth) method(url string) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository URL: %w", err)
+	}
+
+	switch ep.Protocol {
+	case "ssh":
+		if a.Username != "" || a.Password != "" {
+			return nil, errors.New("HTTP credentials cannot be used with an SSH URL")
+		}
+		return a.sshMethod(cmp.Or(ep.User, "git"))
+	case "http", "https":
+		if a.SSHKeyFile != "" || a.SSHAgent {
+			return nil, errors.New("SSH credentials cannot be used with an HTTP URL")
+		}
+		if a.Password == "" {
+			if a.Username != "" {
+				return nil, fmt.Errorf("username %q is set but no password or token is configured", a.Username)
+			}
+			return nil, nil
+		}
+		return &http.BasicAuth{Username: cmp.Or(a.Username, "git"), Password: a.Password}, nil
+	default:
+		if a != (Auth{}) {
+			return nil, fmt.Errorf("credentials are not supported for %s URLs", ep.Protocol)
+		}
+		return nil, nil
+	}
+}
+
+// sshMethod returns the SSH auth method for user.
+func (a Auth) sshMethod(user string) (transport.AuthMethod, error) {
+	callback, err := a.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	if a.SSHKeyFile != "" {
+		keys, err := gitssh.NewPublicKeysFromFile(user, a.SSHKeyFile, a.SSHKeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SSH key: %w", err)
+		}
+		keys.HostKeyCallback = callback
+		return keys, nil
+	}
+
+	// go-git uses the agent by default, but a custom host key callback can
+	// only be set on an explicit auth method.
+	if a.SSHAgent || callback != nil {
+		agent, err := gitssh.NewSSHAgentAuth(user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to SSH agent: %w", err)
+		}
+		agent.HostKeyCallback = callback
+		return agent, nil
+	}
+	return nil, nil
+}
+
+// hostKeyCallback returns the host key callback for the configured policy,
+// or nil to use go-git's default known_hosts files.
+func (a Auth) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	switch cmp.Or(a.HostKeyPolicy, HostKeyStrict) {
+	case HostKeyStrict:
+		if a.KnownHostsFile == "" {
+			return nil, nil
+		}
+		callback, err := gitssh.NewKnownHostsCallback(a.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known hosts: %w", err)
+		}
+		return callback, nil
+	case HostKeyAcceptNew:
+		if a.KnownHostsFile == "" {
+			return nil, fmt.Errorf("host key policy %q requires a known hosts file", HostKeyAcceptNew)
+		}
+		return acceptNewHostKeys(a.KnownHostsFile)
+	case HostKeyOff:
+		return ssh.InsecureIgnoreHostKey(), nil //nolint:gosec // explicitly configured
+	default:
+		return nil, fmt.Errorf("unknown host key policy %q", a.HostKeyPolicy)
+	}
+}
+
+// acceptNewHostKeys returns a callback that verifies host keys against the
+// known hosts file at path and appends the keys of hosts it does not list
+// yet, like OpenSSH's StrictHostKeyChecking=accept-new.
+func acceptNewHostKeys(path string) (ssh.HostKeyCallback, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0o600) //nolint:gosec // configured path
+	if err != nil {
+		return nil, fmt.Errorf("failed to open known hosts: %w", err)
+	}
+	_ = f.Close()
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		check, err := knownhosts.New(path)
+		if err != nil {
+			return fmt.Errorf("failed to load known hosts: %w", err)
+		}
+		err = check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+			return err
+		}
+
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600) //nolint:gosec // configured path
+		if err != nil {
+			return fmt.Errorf("failed to record host key: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+		return err
+	}, nil
+}
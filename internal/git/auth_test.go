@@ -0,0 +1,103 @@
+package git
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// TestAuthMethodHTTPS tests that a token is sent as basic auth.
+func TestAuthMethodHTTPS(t *testing.T) {
+	method, err := Auth{Password: "token"}.method("https://example.com/repo.git")
+	require.NoError(t, err)
+	assert.Equal(t, &http.BasicAuth{Username: "git", Password: "token"}, method)
+
+	method, err = Auth{}.method("https://example.com/repo.git")
+	require.NoError(t, err)
+	assert.Nil(t, method)
+}
+
+// TestAuthMethodRejectsMismatchedCredentials tests that credentials for
+// the wrong transport are reported instead of ignored.
+func TestAuthMethodRejectsMismatchedCredentials(t *testing.T) {
+	_, err := Auth{SSHAgent: true}.method("https://example.com/repo.git")
+	assert.ErrorContains(t, err, "SSH credentials cannot be used")
+
+	_, err = Auth{Password: "token"}.method("git@example.com:repo.git")
+	assert.ErrorContains(t, err, "HTTP credentials cannot be used")
+
+	_, err = Auth{Username: "deploy"}.method("git@example.com:repo.git")
+	assert.ErrorContains(t, err, "HTTP credentials cannot be used")
+}
+
+// TestAuthMethodUsernameRequiresPassword tests that a username without a
+// password is reported instead of fetching unauthenticated.
+func TestAuthMethodUsernameRequiresPassword(t *testing.T) {
+	_, err := Auth{Username: "deploy"}.method("https://example.com/repo.git")
+	assert.ErrorContains(t, err, `username "deploy" is set but no password or token is configured`)
+
+	method, err := Auth{Username: "deploy", Password: "secret"}.method("https://example.com/repo.git")
+	require.NoError(t, err)
+	assert.Equal(t, &http.BasicAuth{Username: "deploy", Password: "secret"}, method)
+}
+
+// TestAuthMethodSSHKeyFile tests that the key file is loaded for the user
+// in the URL.
+func TestAuthMethodSSHKeyFile(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600))
+
+	method, err := Auth{SSHKeyFile: keyFile, HostKeyPolicy: HostKeyOff}.method("ssh://deploy@example.com/repo.git")
+	require.NoError(t, err)
+	keys, ok := method.(*gitssh.PublicKeys)
+	require.True(t, ok)
+	assert.Equal(t, "deploy", keys.User)
+	assert.NotNil(t, keys.HostKeyCallback)
+}
+
+// TestAcceptNewHostKeys tests that unknown hosts are recorded and a
+// changed key is rejected.
+func TestAcceptNewHostKeys(t *testing.T) {
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	callback, err := Auth{KnownHostsFile: knownHosts, HostKeyPolicy: HostKeyAcceptNew}.hostKeyCallback()
+	require.NoError(t, err)
+
+	newKey := func() ssh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		key, err := ssh.NewPublicKey(pub)
+		require.NoError(t, err)
+		return key
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22}
+	key := newKey()
+
+	require.NoError(t, callback("example.com:22", addr, key))
+	data, err := os.ReadFile(knownHosts)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "example.com ssh-ed25519 ")
+
+	assert.NoError(t, callback("example.com:22", addr, key))
+	assert.Error(t, callback("example.com:22", addr, newKey()))
+}
+
+// TestHostKeyCallbackAcceptNewRequiresFile tests that accept-new has
+// somewhere to record keys.
+func TestHostKeyCallbackAcceptNewRequiresFile(t *testing.T) {
+	_, err := Auth{HostKeyPolicy: HostKeyAcceptNew}.hostKeyCallback()
+	assert.ErrorContains(t, err, "requires a known hosts file")
+}
@@ -3,20 +3,36 @@ package git
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/trly/quad-ops/internal/semver"
 )
 
 // Repository represents a Git repository to sync to a local path.
 type Repository struct {
-	Name       string // repository identifier
-	URL        string // remote git URL
-	Reference  string // git ref: branch, tag, or commit hash
-	ComposeDir string // optional subdirectory in repo containing compose files
-	Path       string // local path where repository will be cloned/synced
-	repo       *git.Repository
+	Name         string        // repository identifier
+	URL          string        // remote git URL
+	Reference    string        // git ref: branch, tag, commit hash, or semver constraint
+	ComposeDir   string        // optional subdirectory in repo containing compose files
+	Path         string        // local path where repository will be cloned/synced
+	Auth         Auth          // credentials for the remote
+	Depth        int           // number of commits to fetch from each ref tip; 0 fetches full history
+	Sparse       bool          // check out only ComposeDir
+	FetchTimeout time.Duration // limit on the clone or fetch; 0 means none beyond the context
+	Verifier     *Verifier     // if set, Sync only checks out commits signed by a trusted key
+	repo         *git.Repository
 }
 
 // New creates a new Repository instance.
@@ -31,83 +47,409 @@ func New(name, url, ref, composeDir, path string) *Repository {
 }
 
 // Sync clones the remote repository to the local path if it doesn't exist,
-// or opens the existing repository and pulls the latest changes if it does.
+// or fetches all branches and tags into the existing clone if it does. The
+// worktree is then hard reset to the commit Reference resolves to on the
+// remote, so force-pushes, a changed Reference, and local modifications are
+// all handled the same way. An existing clone whose sparse checkout no
+// longer matches the configuration is removed and cloned again.
+// Submodules are then updated to the commits the checked out commit records.
 // It returns an error if any Git operations fail.
-// Context can be used to signal cancellation.
+// Cancelling ctx or exceeding FetchTimeout aborts the clone or fetch,
+// including the fetches of submodules.
 func (r *Repository) Sync(ctx context.Context) error {
-	cloneOptions := &git.CloneOptions{URL: r.URL}
+	auth, err := r.Auth.method(r.URL)
+	if err != nil {
+		return fmt.Errorf("failed to configure authentication: %w", err)
+	}
+
+	fetchCtx := ctx
+	if r.FetchTimeout > 0 {
+		var cancel context.CancelFunc
+		fetchCtx, cancel = context.WithTimeout(ctx, r.FetchTimeout)
+		defer cancel()
+	}
+	if err := r.fetch(fetchCtx, auth); err != nil {
+		return r.fetchError(ctx, err)
+	}
 
-	repo, err := git.PlainClone(r.Path, false, cloneOptions)
+	t, err := r.resolveTarget()
 	if err != nil {
-		if err == git.ErrRepositoryAlreadyExists {
-			repo, err = git.PlainOpen(r.Path)
-			if err != nil {
-				return err
-			}
+		return err
+	}
+	if r.Verifier != nil {
+		if err := r.verifyTarget(t); err != nil {
+			return err
+		}
+	}
+	if err := r.checkout(t.hash, t.branch); err != nil {
+		return err
+	}
+	if err := r.updateSubmodules(fetchCtx, auth, false); err != nil {
+		return r.fetchError(ctx, err)
+	}
+	return nil
+}
 
-			r.repo = repo
-			if err := r.pullLatest(ctx); err != nil {
-				return err
+// fetchError reports err as a timeout if FetchTimeout expired while the
+// caller's ctx is still live.
+func (r *Repository) fetchError(ctx context.Context, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return fmt.Errorf("fetch timed out after %s: %w", r.FetchTimeout, err)
+	}
+	return err
+}
+
+// fetch clones the repository, or fetches into the existing clone.
+func (r *Repository) fetch(ctx context.Context, auth transport.AuthMethod) error {
+	cloneOptions := &git.CloneOptions{
+		URL:        r.URL,
+		Auth:       auth,
+		Depth:      r.Depth,
+		NoCheckout: r.sparseDir() != "",
+	}
+
+	repo, err := git.PlainCloneContext(ctx, r.Path, false, cloneOptions)
+	if err == git.ErrRepositoryAlreadyExists {
+		repo, err = git.PlainOpen(r.Path)
+		if err != nil {
+			return err
+		}
+
+		changed, err := r.layoutChanged(repo)
+		if err != nil {
+			return err
+		}
+		if changed {
+			slog.Info("sparse checkout settings changed, cloning again", "repo", r.Name)
+			if err := os.RemoveAll(r.Path); err != nil {
+				return fmt.Errorf("failed to remove existing clone: %w", err)
 			}
+			repo, err = git.PlainCloneContext(ctx, r.Path, false, cloneOptions)
 		} else {
-			return err
+			r.repo = repo
+			err = r.fetchLatest(ctx, auth)
 		}
 	}
+	if err != nil {
+		return err
+	}
 
 	r.repo = repo
+	return nil
+}
+
+// sparseDir returns the directory prefix to check out, with a trailing
+// slash so that sibling directories sharing its name are excluded, or ""
+// when the whole tree is checked out.
+func (r *Repository) sparseDir() string {
+	if !r.Sparse {
+		return ""
+	}
+	dir := path.Clean(strings.Trim(r.ComposeDir, "/"))
+	if dir == "." {
+		return ""
+	}
+	return dir + "/"
+}
 
-	if r.Reference != "" {
-		return r.checkoutTarget()
+// sparseDirs returns the paths to limit a checkout to, or nil for a full
+// checkout. .gitmodules is kept so submodules inside the directory can be
+// found.
+func (r *Repository) sparseDirs() []string {
+	if dir := r.sparseDir(); dir != "" {
+		return []string{dir, gitModulesFile}
 	}
 	return nil
 }
 
-// checkoutTarget attempts to checkout the target reference, which can be a commit hash,
-// tag, or branch. It tries to checkout as a branch first, then falls back to hash checkout.
-func (r *Repository) checkoutTarget() error {
-	// Resolve the reference to get the actual commit hash
+// gitModulesFile lists the submodules of a repository.
+const gitModulesFile = ".gitmodules"
+
+// inSparse reports whether the file at name is part of the sparse checkout.
+func (r *Repository) inSparse(name string) bool {
+	dirs := r.sparseDirs()
+	return dirs == nil || slices.ContainsFunc(dirs, func(dir string) bool {
+		return strings.HasPrefix(name, dir)
+	})
+}
+
+// pruneSparse removes files outside the sparse checkout from the worktree.
+// go-git marks them as skipped in the index but does not delete files that
+// an earlier checkout wrote.
+func (r *Repository) pruneSparse() error {
+	if r.sparseDir() == "" {
+		return nil
+	}
+	idx, err := r.repo.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+	for _, e := range idx.Entries {
+		if !e.SkipWorktree {
+			continue
+		}
+		name := filepath.Join(r.Path, filepath.FromSlash(e.Name))
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove file outside sparse checkout: %w", err)
+		}
+		// Remove directories left empty, stopping at the first that is not.
+		for dir := filepath.Dir(name); dir != r.Path; dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// layoutChanged reports whether the files checked out in repo differ from
+// what the sparse checkout settings select. go-git can narrow a checkout
+// but not widen it again, so such a clone has to be replaced.
+func (r *Repository) layoutChanged(repo *git.Repository) (bool, error) {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return false, fmt.Errorf("failed to read index: %w", err)
+	}
+	for _, e := range idx.Entries {
+		if e.SkipWorktree == r.inSparse(e.Name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// remoteHead is where fetchLatest records the commit the remote's HEAD
+// points to.
+const remoteHead plumbing.ReferenceName = "refs/remotes/origin/HEAD"
+
+// fetchRefSpecs fetch every branch, the remote's default branch, and every
+// tag, overwriting local copies that were force-pushed or moved.
+var fetchRefSpecs = []config.RefSpec{
+	"+refs/heads/*:refs/remotes/origin/*",
+	"+HEAD:" + config.RefSpec(remoteHead),
+	"+refs/tags/*:refs/tags/*",
+}
+
+// fetchLatest fetches all branches and tags from the remote and prunes
+// those deleted there. It returns an error if any Git operations fail,
+// except when the repository is already up to date.
+func (r *Repository) fetchLatest(ctx context.Context, auth transport.AuthMethod) error {
+	err := r.repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   fetchRefSpecs,
+		Auth:       auth,
+		Depth:      r.Depth,
+		Tags:       git.AllTags,
+		Force:      true,
+		Prune:      true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+	return nil
+}
+
+// target is the commit a Reference resolves to.
+type target struct {
+	hash plumbing.Hash
+	// branch is the local branch to attach HEAD to when Reference is a
+	// branch.
+	branch plumbing.ReferenceName
+	// tag is the tag Reference names or, for a semver Reference, selected.
+	tag string
+}
+
+// resolveTarget returns the commit Reference points to. A branch is looked
+// up on the remote rather than locally. Without a Reference the remote's
+// default branch is used.
+func (r *Repository) resolveTarget() (target, error) {
+	if r.Reference == "" {
+		// A fresh clone has checked out the default branch but not
+		// recorded the remote's HEAD.
+		for _, name := range []plumbing.ReferenceName{remoteHead, plumbing.HEAD} {
+			if ref, err := r.repo.Reference(name, true); err == nil {
+				return target{hash: ref.Hash()}, nil
+			}
+		}
+		return target{}, fmt.Errorf("failed to resolve the remote's default branch")
+	}
+
+	if constraint, ok := strings.CutPrefix(r.Reference, semver.Prefix); ok {
+		tag, err := r.highestTag(constraint)
+		if err != nil {
+			return target{}, err
+		}
+		hash, err := r.repo.ResolveRevision(plumbing.Revision(plumbing.NewTagReferenceName(tag)))
+		if err != nil {
+			return target{}, fmt.Errorf("tag %q not found: %w", tag, err)
+		}
+		slog.Info("resolved semver reference", "repo", r.Name, "ref", r.Reference, "tag", tag)
+		return target{hash: *hash, tag: tag}, nil
+	}
+
+	if ref, err := r.repo.Reference(plumbing.NewRemoteReferenceName("origin", r.Reference), true); err == nil {
+		return target{hash: ref.Hash(), branch: plumbing.NewBranchReferenceName(r.Reference)}, nil
+	}
+
+	// Resolve tags, commit hashes, and other revisions to a commit.
 	hash, err := r.repo.ResolveRevision(plumbing.Revision(r.Reference))
 	if err != nil {
-		return fmt.Errorf("reference %q not found: %w", r.Reference, err)
+		return target{}, fmt.Errorf("reference %q not found: %w", r.Reference, err)
+	}
+	t := target{hash: *hash}
+	if _, err := r.repo.Tag(r.Reference); err == nil {
+		t.tag = r.Reference
 	}
+	return t, nil
+}
 
+// verifyTarget checks that the commit to deploy, or the annotated tag it
+// was resolved from, is signed by a trusted key. A failed check leaves the
+// worktree at the previous commit.
+func (r *Repository) verifyTarget(t target) error {
+	if t.tag != "" {
+		if ref, err := r.repo.Tag(t.tag); err == nil {
+			if tag, err := r.repo.TagObject(ref.Hash()); err == nil {
+				if signer, err := r.Verifier.VerifyTag(tag); err == nil {
+					slog.Info("verified tag signature", "repo", r.Name, "tag", t.tag, "key", signer)
+					return nil
+				}
+			}
+		}
+	}
+
+	commit, err := r.repo.CommitObject(t.hash)
+	if err != nil {
+		return fmt.Errorf("failed to read commit %s: %w", t.hash, err)
+	}
+	signer, err := r.Verifier.VerifyCommit(commit)
+	if err != nil {
+		return fmt.Errorf("refusing to deploy commit %s: %w", t.hash, err)
+	}
+	slog.Info("verified commit signature", "repo", r.Name, "commit", t.hash.String(), "key", signer)
+	return nil
+}
+
+// checkoutTarget hard resets the worktree to the commit Reference resolves
+// to, without verifying it.
+func (r *Repository) checkoutTarget() error {
+	t, err := r.resolveTarget()
+	if err != nil {
+		return err
+	}
+	return r.checkout(t.hash, t.branch)
+}
+
+// checkout hard resets the worktree to hash, discarding local changes and
+// untracked files. HEAD is attached to branch, which is moved to hash, or
+// detached when branch is empty.
+func (r *Repository) checkout(hash plumbing.Hash, branch plumbing.ReferenceName) error {
 	worktree, err := r.repo.Worktree()
 	if err != nil {
 		return err
 	}
 
-	// Try to checkout as a branch first to keep HEAD attached
-	branchRef := plumbing.NewBranchReferenceName(r.Reference)
-	err = worktree.Checkout(&git.CheckoutOptions{
-		Branch: branchRef,
-		Create: false,
-	})
-	if err == nil {
-		return nil
+	opts := &git.CheckoutOptions{Hash: hash, Force: true, SparseCheckoutDirectories: r.sparseDirs()}
+	if branch != "" {
+		if err := r.repo.Storer.SetReference(plumbing.NewHashReference(branch, hash)); err != nil {
+			return fmt.Errorf("failed to update branch %s: %w", branch.Short(), err)
+		}
+		opts = &git.CheckoutOptions{Branch: branch, Force: true, SparseCheckoutDirectories: r.sparseDirs()}
+	}
+	if err := worktree.Checkout(opts); err != nil {
+		return fmt.Errorf("failed to check out %s: %w", hash, err)
 	}
 
-	// Fall back to checkout by hash (for tags, commits, or non-existent branches)
-	return worktree.Checkout(&git.CheckoutOptions{Hash: *hash})
+	if err := worktree.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return fmt.Errorf("failed to remove untracked files: %w", err)
+	}
+	return r.pruneSparse()
 }
 
-// pullLatest pulls the latest changes from the remote repository.
-// It returns an error if any Git operations fail, except when the repository
-// is already up to date.
-func (r *Repository) pullLatest(_ context.Context) error {
+// updateSubmodules initializes the submodules of the checked out commit and
+// checks each out at the commit recorded for it, recursively. Local changes
+// and untracked files in a submodule are discarded first. Submodules outside
+// a sparse checkout are left alone. With noFetch only commits already in the
+// clone are used.
+func (r *Repository) updateSubmodules(ctx context.Context, auth transport.AuthMethod, noFetch bool) error {
 	worktree, err := r.repo.Worktree()
 	if err != nil {
 		return err
 	}
+	subs, err := worktree.Submodules()
+	if err != nil {
+		return fmt.Errorf("failed to read submodules: %w", err)
+	}
 
-	err = worktree.Pull(&git.PullOptions{RemoteName: "origin"})
-	if err != nil && err != git.NoErrAlreadyUpToDate {
-		return err
+	for _, sub := range subs {
+		cfg := sub.Config()
+		// A submodule can also contain the sparse directory.
+		if !r.inSparse(cfg.Path) && !strings.HasPrefix(r.sparseDir(), cfg.Path+"/") {
+			continue
+		}
+		if err := resetSubmodule(sub); err != nil {
+			return fmt.Errorf("failed to reset submodule %s: %w", cfg.Path, err)
+		}
+		err := sub.UpdateContext(ctx, &git.SubmoduleUpdateOptions{
+			Init:              true,
+			NoFetch:           noFetch,
+			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+			Auth:              r.submoduleAuth(cfg.URL, auth),
+			Depth:             r.Depth,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update submodule %s: %w", cfg.Path, err)
+		}
 	}
 	return nil
 }
 
+// resetSubmodule discards local changes and untracked files in an
+// initialized submodule, which would otherwise stop its checkout.
+func resetSubmodule(sub *git.Submodule) error {
+	status, err := sub.Status()
+	if err != nil {
+		return err
+	}
+	if status.Current.IsZero() {
+		return nil
+	}
+	repo, err := sub.Repository()
+	if err != nil {
+		return err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := worktree.Reset(&git.ResetOptions{Mode: git.HardReset}); err != nil {
+		return err
+	}
+	return worktree.Clean(&git.CleanOptions{Dir: true})
+}
+
+// submoduleAuth returns the auth method for a submodule at url. Submodules
+// fetched over the same protocol as the repository, including those with
+// relative URLs, use its credentials; others use go-git's defaults.
+func (r *Repository) submoduleAuth(url string, auth transport.AuthMethod) transport.AuthMethod {
+	if strings.HasPrefix(url, "./") || strings.HasPrefix(url, "../") {
+		return auth
+	}
+	parent, err := transport.NewEndpoint(r.URL)
+	if err != nil {
+		return nil
+	}
+	ep, err := transport.NewEndpoint(url)
+	if err != nil || ep.Protocol != parent.Protocol {
+		return nil
+	}
+	return auth
+}
+
 // CheckoutRef opens an existing repository and checks out the given reference
 // without fetching from the remote. Used for rollback to a known commit.
+// Submodules are returned to the commits recorded in it, which an earlier
+// Sync has fetched.
 func (r *Repository) CheckoutRef(ref string) error {
 	repo, err := git.PlainOpen(r.Path)
 	if err != nil {
@@ -115,7 +457,10 @@ func (r *Repository) CheckoutRef(ref string) error {
 	}
 	r.repo = repo
 	r.Reference = ref
-	return r.checkoutTarget()
+	if err := r.checkoutTarget(); err != nil {
+		return err
+	}
+	return r.updateSubmodules(context.Background(), nil, true)
 }
 
 // GetCurrentCommitHash returns the current HEAD commit hash.
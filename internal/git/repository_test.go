@@ -2,6 +2,7 @@ package git
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/stretchr/testify/require"
 )
@@ -111,7 +113,7 @@ func TestCheckoutTargetWithLocalRepo(t *testing.T) {
 	require.Equal(t, commitHash, ref.Hash().String())
 }
 
-func TestPullLatest(t *testing.T) {
+func TestFetchLatest(t *testing.T) {
 	tmpDir := setupTest(t)
 
 	// Create a "remote" repository
@@ -145,17 +147,18 @@ func TestPullLatest(t *testing.T) {
 	})
 	require.NoError(t, err)
 
-	// Test pullLatest - should pull the new commit
-	err = repo.pullLatest(context.Background())
+	// Test fetchLatest - should fetch the new commit
+	err = repo.fetchLatest(context.Background(), nil)
 	require.NoError(t, err)
 
-	// Verify the new commit was pulled
+	// Verify the new commit is checked out
+	require.NoError(t, repo.checkoutTarget())
 	ref, err := repo.repo.Head()
 	require.NoError(t, err)
 	require.Equal(t, newCommit.String(), ref.Hash().String())
 
-	// Test pullLatest again - should be already up to date
-	err = repo.pullLatest(context.Background())
+	// Test fetchLatest again - should be already up to date
+	err = repo.fetchLatest(context.Background(), nil)
 	require.NoError(t, err)
 }
 
@@ -409,3 +412,341 @@ func TestNewWithAllFields(t *testing.T) {
 	require.Equal(t, "examples", repo.ComposeDir)
 	require.Equal(t, "/test/path", repo.Path)
 }
+
+// commitFiles writes files into the repository at repoDir and commits them.
+func commitFiles(t *testing.T, repo *git.Repository, repoDir string, files map[string]string) string {
+	t.Helper()
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+
+	for name, content := range files {
+		path := filepath.Join(repoDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		_, err = worktree.Add(name)
+		require.NoError(t, err)
+	}
+
+	commit, err := worktree.Commit("update files", &git.CommitOptions{
+		Author: &object.Signature{Name: "Test User", Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+	return commit.String()
+}
+
+func TestSyncShallowClone(t *testing.T) {
+	tmpDir := setupTest(t)
+
+	remoteRepoDir := filepath.Join(tmpDir, "remote-repo")
+	remoteRepo, _ := createTestRepo(t, remoteRepoDir)
+	head := commitFiles(t, remoteRepo, remoteRepoDir, map[string]string{"test.txt": "second"})
+
+	repoPath := filepath.Join(tmpDir, "test-repo")
+	repo := New("test-repo", remoteRepoDir, "", "", repoPath)
+	repo.Depth = 1
+	require.NoError(t, repo.Sync(context.Background()))
+
+	shallow, err := repo.repo.Storer.Shallow()
+	require.NoError(t, err)
+	require.Equal(t, []plumbing.Hash{plumbing.NewHash(head)}, shallow)
+}
+
+func TestSyncSparseCheckout(t *testing.T) {
+	tmpDir := setupTest(t)
+
+	remoteRepoDir := filepath.Join(tmpDir, "remote-repo")
+	remoteRepo, _ := createTestRepo(t, remoteRepoDir)
+	commitFiles(t, remoteRepo, remoteRepoDir, map[string]string{
+		"deploy/compose.yml":     "services: {}",
+		"deploy-old/compose.yml": "services: {}",
+	})
+
+	repoPath := filepath.Join(tmpDir, "test-repo")
+	repo := New("test-repo", remoteRepoDir, "", "deploy", repoPath)
+	repo.Sparse = true
+	require.NoError(t, repo.Sync(context.Background()))
+
+	require.FileExists(t, filepath.Join(repoPath, "deploy", "compose.yml"))
+	require.NoFileExists(t, filepath.Join(repoPath, "deploy-old", "compose.yml"))
+	require.NoFileExists(t, filepath.Join(repoPath, "test.txt"))
+
+	// Updates stay limited to the compose directory.
+	commitFiles(t, remoteRepo, remoteRepoDir, map[string]string{
+		"deploy/compose.yml": "services:\n  web: {}",
+		"other.txt":          "unrelated",
+	})
+	require.NoError(t, repo.Sync(context.Background()))
+
+	content, err := os.ReadFile(filepath.Join(repoPath, "deploy", "compose.yml"))
+	require.NoError(t, err)
+	require.Equal(t, "services:\n  web: {}", string(content))
+	require.NoFileExists(t, filepath.Join(repoPath, "other.txt"))
+}
+
+func TestSyncReclonesWhenSparseDisabled(t *testing.T) {
+	tmpDir := setupTest(t)
+
+	remoteRepoDir := filepath.Join(tmpDir, "remote-repo")
+	remoteRepo, _ := createTestRepo(t, remoteRepoDir)
+	commitFiles(t, remoteRepo, remoteRepoDir, map[string]string{"deploy/compose.yml": "services: {}"})
+
+	repoPath := filepath.Join(tmpDir, "test-repo")
+	repo := New("test-repo", remoteRepoDir, "", "deploy", repoPath)
+	repo.Sparse = true
+	require.NoError(t, repo.Sync(context.Background()))
+	require.NoFileExists(t, filepath.Join(repoPath, "test.txt"))
+
+	repo = New("test-repo", remoteRepoDir, "", "deploy", repoPath)
+	require.NoError(t, repo.Sync(context.Background()))
+	require.FileExists(t, filepath.Join(repoPath, "test.txt"))
+}
+
+func TestSyncCancelledContext(t *testing.T) {
+	tmpDir := setupTest(t)
+
+	remoteRepoDir := filepath.Join(tmpDir, "remote-repo")
+	createTestRepo(t, remoteRepoDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	repoPath := filepath.Join(tmpDir, "test-repo")
+	repo := New("test-repo", remoteRepoDir, "", "", repoPath)
+	err := repo.Sync(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.NoDirExists(t, repoPath)
+}
+
+func TestSyncFetchTimeout(t *testing.T) {
+	tmpDir := setupTest(t)
+
+	remoteRepoDir := filepath.Join(tmpDir, "remote-repo")
+	createTestRepo(t, remoteRepoDir)
+
+	repoPath := filepath.Join(tmpDir, "test-repo")
+	repo := New("test-repo", remoteRepoDir, "", "", repoPath)
+	repo.FetchTimeout = time.Nanosecond
+	err := repo.Sync(context.Background())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, err, "fetch timed out after 1ns")
+}
+
+func TestSyncAfterForcePush(t *testing.T) {
+	tmpDir := setupTest(t)
+
+	remoteRepoDir := filepath.Join(tmpDir, "remote-repo")
+	remoteRepo, first := createTestRepo(t, remoteRepoDir)
+	commitFiles(t, remoteRepo, remoteRepoDir, map[string]string{"test.txt": "pushed"})
+
+	repoPath := filepath.Join(tmpDir, "test-repo")
+	repo := New("test-repo", remoteRepoDir, "master", "", repoPath)
+	require.NoError(t, repo.Sync(context.Background()))
+
+	// Rewrite the remote branch so the clone's commit is no longer on it.
+	remoteWorktree, err := remoteRepo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, remoteWorktree.Reset(&git.ResetOptions{Commit: plumbing.NewHash(first), Mode: git.HardReset}))
+	rewritten := commitFiles(t, remoteRepo, remoteRepoDir, map[string]string{"test.txt": "rewritten"})
+
+	require.NoError(t, repo.Sync(context.Background()))
+	hash, err := repo.GetCurrentCommitHash()
+	require.NoError(t, err)
+	require.Equal(t, rewritten, hash)
+
+	content, err := os.ReadFile(filepath.Join(repoPath, "test.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "rewritten", string(content))
+}
+
+func TestSyncChangedReference(t *testing.T) {
+	tmpDir := setupTest(t)
+
+	remoteRepoDir := filepath.Join(tmpDir, "remote-repo")
+	remoteRepo, first := createTestRepo(t, remoteRepoDir)
+	_, err := remoteRepo.CreateTag("v1.0.0", plumbing.NewHash(first), nil)
+	require.NoError(t, err)
+	second := commitFiles(t, remoteRepo, remoteRepoDir, map[string]string{"test.txt": "second"})
+	require.NoError(t, remoteRepo.Storer.SetReference(plumbing.NewHashReference("refs/heads/stable", plumbing.NewHash(first))))
+
+	repoPath := filepath.Join(tmpDir, "test-repo")
+	for _, tc := range []struct{ ref, want string }{
+		{"master", second},
+		{"v1.0.0", first},
+		{"master", second},
+		{"stable", first},
+	} {
+		repo := New("test-repo", remoteRepoDir, tc.ref, "", repoPath)
+		require.NoError(t, repo.Sync(context.Background()), tc.ref)
+
+		hash, err := repo.GetCurrentCommitHash()
+		require.NoError(t, err)
+		require.Equal(t, tc.want, hash, tc.ref)
+	}
+
+	// Later commits on the branch are picked up after switching to it.
+	remoteWorktree, err := remoteRepo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, remoteWorktree.Checkout(&git.CheckoutOptions{Branch: "refs/heads/stable"}))
+	third := commitFiles(t, remoteRepo, remoteRepoDir, map[string]string{"test.txt": "stable"})
+
+	repo := New("test-repo", remoteRepoDir, "stable", "", repoPath)
+	require.NoError(t, repo.Sync(context.Background()))
+	head, err := repo.repo.Head()
+	require.NoError(t, err)
+	require.Equal(t, plumbing.ReferenceName("refs/heads/stable"), head.Name())
+	require.Equal(t, third, head.Hash().String())
+}
+
+func TestSyncDiscardsLocalChanges(t *testing.T) {
+	tmpDir := setupTest(t)
+
+	remoteRepoDir := filepath.Join(tmpDir, "remote-repo")
+	createTestRepo(t, remoteRepoDir)
+
+	repoPath := filepath.Join(tmpDir, "test-repo")
+	repo := New("test-repo", remoteRepoDir, "", "", repoPath)
+	require.NoError(t, repo.Sync(context.Background()))
+
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "test.txt"), []byte("edited"), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(repoPath, "stray"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "stray", "compose.yml"), []byte("services: {}"), 0o600))
+
+	require.NoError(t, repo.Sync(context.Background()))
+
+	content, err := os.ReadFile(filepath.Join(repoPath, "test.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "initial content", string(content))
+	require.NoDirExists(t, filepath.Join(repoPath, "stray"))
+}
+
+func TestSyncSemverReference(t *testing.T) {
+	tmpDir := setupTest(t)
+
+	remoteRepoDir := filepath.Join(tmpDir, "remote-repo")
+	remoteRepo, _ := createTestRepo(t, remoteRepoDir)
+	tags := map[string]string{}
+	for _, tag := range []string{"v1.3.9", "v1.4.0", "v1.4.2", "1.4.10-rc.1", "v2.0.0", "latest"} {
+		tags[tag] = commitFiles(t, remoteRepo, remoteRepoDir, map[string]string{"test.txt": tag})
+		_, err := remoteRepo.CreateTag(tag, plumbing.NewHash(tags[tag]), nil)
+		require.NoError(t, err)
+	}
+
+	repoPath := filepath.Join(tmpDir, "test-repo")
+	repo := New("test-repo", remoteRepoDir, "semver:~1.4", "", repoPath)
+	require.NoError(t, repo.Sync(context.Background()))
+
+	hash, err := repo.GetCurrentCommitHash()
+	require.NoError(t, err)
+	require.Equal(t, tags["v1.4.2"], hash)
+
+	// A new patch release is picked up on the next sync.
+	patch := commitFiles(t, remoteRepo, remoteRepoDir, map[string]string{"test.txt": "v1.4.3"})
+	_, err = remoteRepo.CreateTag("v1.4.3", plumbing.NewHash(patch), nil)
+	require.NoError(t, err)
+	require.NoError(t, repo.Sync(context.Background()))
+
+	hash, err = repo.GetCurrentCommitHash()
+	require.NoError(t, err)
+	require.Equal(t, patch, hash)
+
+	repo = New("test-repo", remoteRepoDir, "semver:^3", "", repoPath)
+	require.ErrorContains(t, repo.Sync(context.Background()), `no tag satisfies semver constraint "^3"`)
+
+	repo = New("test-repo", remoteRepoDir, "semver:not a version", "", repoPath)
+	require.ErrorContains(t, repo.Sync(context.Background()), "invalid semver constraint")
+}
+
+// commitSubmodules records each submodule path at the commit of the
+// repository at its URL, the way `git submodule add` does, and commits.
+func commitSubmodules(t *testing.T, repo *git.Repository, repoDir string, submodules map[string]string) string {
+	t.Helper()
+	idx, err := repo.Storer.Index()
+	require.NoError(t, err)
+
+	var gitmodules string
+	for path, url := range submodules {
+		sub, err := git.PlainOpen(url)
+		require.NoError(t, err)
+		head, err := sub.Head()
+		require.NoError(t, err)
+
+		e, err := idx.Entry(path)
+		if err != nil {
+			e = idx.Add(path)
+		}
+		e.Mode = filemode.Submodule
+		e.Hash = head.Hash()
+		gitmodules += fmt.Sprintf("[submodule %q]\n\tpath = %s\n\turl = %s\n", path, path, url)
+	}
+	require.NoError(t, repo.Storer.SetIndex(idx))
+	return commitFiles(t, repo, repoDir, map[string]string{".gitmodules": gitmodules})
+}
+
+func TestSyncSubmodules(t *testing.T) {
+	tmpDir := setupTest(t)
+
+	sharedDir := filepath.Join(tmpDir, "shared")
+	shared, _ := createTestRepo(t, sharedDir)
+	commitFiles(t, shared, sharedDir, map[string]string{"common.yml": "v1"})
+
+	remoteRepoDir := filepath.Join(tmpDir, "remote-repo")
+	remoteRepo, _ := createTestRepo(t, remoteRepoDir)
+	first := commitSubmodules(t, remoteRepo, remoteRepoDir, map[string]string{"shared": sharedDir})
+
+	repoPath := filepath.Join(tmpDir, "test-repo")
+	repo := New("test-repo", remoteRepoDir, "", "", repoPath)
+	require.NoError(t, repo.Sync(context.Background()))
+
+	common := filepath.Join(repoPath, "shared", "common.yml")
+	content, err := os.ReadFile(common)
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(content))
+
+	// Moving the submodule in the parent is picked up, and local changes in
+	// the submodule are discarded.
+	commitFiles(t, shared, sharedDir, map[string]string{"common.yml": "v2"})
+	commitSubmodules(t, remoteRepo, remoteRepoDir, map[string]string{"shared": sharedDir})
+	require.NoError(t, os.WriteFile(common, []byte("local"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(repoPath, "shared", "untracked.yml"), nil, 0o600))
+	require.NoError(t, repo.Sync(context.Background()))
+
+	content, err = os.ReadFile(common)
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(content))
+	require.NoFileExists(t, filepath.Join(repoPath, "shared", "untracked.yml"))
+
+	// Rolling back restores the submodule commit the parent recorded.
+	rollback := New("test-repo", remoteRepoDir, "", "", repoPath)
+	require.NoError(t, rollback.CheckoutRef(first))
+
+	content, err = os.ReadFile(common)
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(content))
+}
+
+func TestSyncSparseCheckoutSubmodules(t *testing.T) {
+	tmpDir := setupTest(t)
+
+	sharedDir := filepath.Join(tmpDir, "shared")
+	shared, _ := createTestRepo(t, sharedDir)
+	commitFiles(t, shared, sharedDir, map[string]string{"common.yml": "shared"})
+
+	remoteRepoDir := filepath.Join(tmpDir, "remote-repo")
+	remoteRepo, _ := createTestRepo(t, remoteRepoDir)
+	commitSubmodules(t, remoteRepo, remoteRepoDir, map[string]string{
+		"stack/shared": sharedDir,
+		"other/shared": sharedDir,
+	})
+
+	repoPath := filepath.Join(tmpDir, "test-repo")
+	repo := New("test-repo", remoteRepoDir, "", "stack", repoPath)
+	repo.Sparse = true
+	require.NoError(t, repo.Sync(context.Background()))
+
+	require.FileExists(t, filepath.Join(repoPath, "stack", "shared", "common.yml"))
+	require.NoDirExists(t, filepath.Join(repoPath, "other"))
+
+	// The next sync reuses the clone.
+	require.NoError(t, repo.Sync(context.Background()))
+	require.FileExists(t, filepath.Join(repoPath, "stack", "shared", "common.yml"))
+}
@@ -0,0 +1,26 @@
+package git
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/trly/quad-ops/internal/semver"
+)
+
+// highestTag returns the name of the highest tag that satisfies constraint.
+// Tags that are not semantic versions are ignored.
+func (r *Repository) highestTag(constraint string) (string, error) {
+	iter, err := r.repo.Tags()
+	if err != nil {
+		return "", fmt.Errorf("failed to list tags: %w", err)
+	}
+	var tags []string
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		tags = append(tags, ref.Name().Short())
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list tags: %w", err)
+	}
+	return semver.Highest(constraint, tags)
+}
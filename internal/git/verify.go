@@ -0,0 +1,213 @@
+package git
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha256" // registers crypto.SHA256 for SSH signatures
+	_ "crypto/sha512" // registers crypto.SHA512 for SSH signatures
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrUntrusted is returned when the commit to deploy is not signed by a
+// trusted key.
+var ErrUntrusted = errors.New("not signed by a trusted key")
+
+const (
+	pgpSignatureHeader = "-----BEGIN PGP SIGNATURE-----"
+	sshSignatureHeader = "-----BEGIN SSH SIGNATURE-----"
+	// sshSigNamespace is the namespace git uses for SSH signatures.
+	sshSigNamespace = "git"
+)
+
+// Verifier checks commit and tag signatures against a set of trusted
+// OpenPGP and SSH public keys.
+type Verifier struct {
+	pgpKeys openpgp.EntityList
+	sshKeys []ssh.PublicKey
+}
+
+// NewVerifier loads the trusted keys from keyFiles. Each file holds either
+// armored OpenPGP public keys or SSH public keys, one per line in
+// authorized_keys or allowed_signers format.
+func NewVerifier(keyFiles []string) (*Verifier, error) {
+	v := &Verifier{}
+	for _, path := range keyFiles {
+		data, err := os.ReadFile(path) //nolint:gosec // configured path
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+		if bytes.Contains(data, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+			keys, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse OpenPGP key %s: %w", path, err)
+			}
+			v.pgpKeys = append(v.pgpKeys, keys...)
+			continue
+		}
+		keys, err := parseSSHKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SSH key %s: %w", path, err)
+		}
+		v.sshKeys = append(v.sshKeys, keys...)
+	}
+	if len(v.pgpKeys) == 0 && len(v.sshKeys) == 0 {
+		return nil, errors.New("no trusted signing keys configured")
+	}
+	return v, nil
+}
+
+// parseSSHKeys parses every non-empty, non-comment line of data as an SSH
+// public key. A leading principal, as in allowed_signers files, is skipped.
+func parseSSHKeys(data []byte) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no keys found")
+	}
+	return keys, nil
+}
+
+// verify checks the signature over the object encoded by encode and
+// returns a description of the trusted key that made it.
+func (v *Verifier) verify(signature string, encode func(plumbing.EncodedObject) error) (string, error) {
+	obj := &plumbing.MemoryObject{}
+	if err := encode(obj); err != nil {
+		return "", err
+	}
+	reader, err := obj.Reader()
+	if err != nil {
+		return "", err
+	}
+	message, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case strings.HasPrefix(signature, pgpSignatureHeader):
+		entity, err := openpgp.CheckArmoredDetachedSignature(v.pgpKeys, bytes.NewReader(message), strings.NewReader(signature), nil)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrUntrusted, err)
+		}
+		return "openpgp:" + entity.PrimaryKey.KeyIdString(), nil
+	case strings.HasPrefix(signature, sshSignatureHeader):
+		key, err := v.verifySSH(message, []byte(signature))
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrUntrusted, err)
+		}
+		return "ssh:" + ssh.FingerprintSHA256(key), nil
+	case signature == "":
+		return "", fmt.Errorf("%w: unsigned", ErrUntrusted)
+	default:
+		return "", fmt.Errorf("%w: unsupported signature format", ErrUntrusted)
+	}
+}
+
+// sshSig is the SSHSIG signature blob, after its magic preamble, as defined
+// by OpenSSH's PROTOCOL.sshsig.
+type sshSig struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      []byte
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// verifySSH verifies an armored SSHSIG signature over message and returns
+// the trusted key that made it.
+func (v *Verifier) verifySSH(message, armored []byte) (ssh.PublicKey, error) {
+	block, _ := pem.Decode(armored)
+	if block == nil || block.Type != "SSH SIGNATURE" {
+		return nil, errors.New("malformed SSH signature")
+	}
+	blob, ok := bytes.CutPrefix(block.Bytes, []byte("SSHSIG"))
+	if !ok {
+		return nil, errors.New("malformed SSH signature")
+	}
+	var sig sshSig
+	if err := ssh.Unmarshal(blob, &sig); err != nil {
+		return nil, fmt.Errorf("malformed SSH signature: %w", err)
+	}
+	if sig.Version != 1 {
+		return nil, fmt.Errorf("unsupported SSH signature version %d", sig.Version)
+	}
+	if sig.Namespace != sshSigNamespace {
+		return nil, fmt.Errorf("SSH signature namespace is %q, not %q", sig.Namespace, sshSigNamespace)
+	}
+
+	key, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("malformed SSH signature key: %w", err)
+	}
+	if !v.trustsSSHKey(key) {
+		return nil, fmt.Errorf("SSH key %s is not trusted", ssh.FingerprintSHA256(key))
+	}
+
+	var hash crypto.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		hash = crypto.SHA256
+	case "sha512":
+		hash = crypto.SHA512
+	default:
+		return nil, fmt.Errorf("unsupported SSH signature hash %q", sig.HashAlgorithm)
+	}
+	h := hash.New()
+	h.Write(message)
+	digest := h.Sum(nil)
+
+	var signature ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &signature); err != nil {
+		return nil, fmt.Errorf("malformed SSH signature: %w", err)
+	}
+	signed := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      []byte
+		HashAlgorithm string
+		Hash          []byte
+	}{sig.Namespace, sig.Reserved, sig.HashAlgorithm, digest})...)
+	if err := key.Verify(signed, &signature); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (v *Verifier) trustsSSHKey(key ssh.PublicKey) bool {
+	for _, trusted := range v.sshKeys {
+		if bytes.Equal(trusted.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyCommit checks that the commit is signed by a trusted key.
+func (v *Verifier) VerifyCommit(c *object.Commit) (string, error) {
+	return v.verify(c.PGPSignature, c.EncodeWithoutSignature)
+}
+
+// VerifyTag checks that the annotated tag is signed by a trusted key.
+func (v *Verifier) VerifyTag(t *object.Tag) (string, error) {
+	return v.verify(t.PGPSignature, t.EncodeWithoutSignature)
+}
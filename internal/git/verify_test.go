@@ -0,0 +1,198 @@
+package git
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshSigner signs git objects the way `git commit -S` does with an SSH key.
+type sshSigner struct {
+	signer ssh.Signer
+}
+
+func newSSHSigner(t *testing.T) sshSigner {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return sshSigner{signer: signer}
+}
+
+func (s sshSigner) Sign(message io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(message)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha512.Sum512(data)
+	signed := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      []byte
+		HashAlgorithm string
+		Hash          []byte
+	}{"git", nil, "sha512", digest[:]})...)
+	sig, err := s.signer.Sign(rand.Reader, signed)
+	if err != nil {
+		return nil, err
+	}
+	blob := append([]byte("SSHSIG"), ssh.Marshal(sshSig{
+		Version:       1,
+		PublicKey:     s.signer.PublicKey().Marshal(),
+		Namespace:     "git",
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(sig),
+	})...)
+	return pem.EncodeToMemory(&pem.Block{Type: "SSH SIGNATURE", Bytes: blob}), nil
+}
+
+// writeKey writes a trusted key file and returns its path.
+func writeKey(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// commitSigned commits a change to the repository at repoDir, signed with
+// opts.
+func commitSigned(t *testing.T, repo *git.Repository, repoDir string, opts git.CommitOptions) string {
+	t.Helper()
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "test.txt"), []byte(time.Now().String()), 0o600))
+	_, err = worktree.Add("test.txt")
+	require.NoError(t, err)
+
+	opts.Author = &object.Signature{Name: "Test User", Email: "test@example.com", When: time.Now()}
+	commit, err := worktree.Commit("signed commit", &opts)
+	require.NoError(t, err)
+	return commit.String()
+}
+
+func TestVerifySSHSignedCommit(t *testing.T) {
+	tmpDir := setupTest(t)
+	signer := newSSHSigner(t)
+	other := newSSHSigner(t)
+
+	remoteRepoDir := filepath.Join(tmpDir, "remote-repo")
+	remoteRepo, _ := createTestRepo(t, remoteRepoDir)
+	trusted := commitSigned(t, remoteRepo, remoteRepoDir, git.CommitOptions{Signer: signer})
+
+	// allowed_signers format, with a principal before the key.
+	keyFile := writeKey(t, "# deploy keys\ntest@example.com "+string(ssh.MarshalAuthorizedKey(signer.signer.PublicKey())))
+	verifier, err := NewVerifier([]string{keyFile})
+	require.NoError(t, err)
+
+	repoPath := filepath.Join(tmpDir, "test-repo")
+	repo := New("test-repo", remoteRepoDir, "", "", repoPath)
+	repo.Verifier = verifier
+	require.NoError(t, repo.Sync(context.Background()))
+
+	// Commits signed by another key, or not at all, are not checked out.
+	for _, opts := range []git.CommitOptions{{Signer: other}, {}} {
+		commitSigned(t, remoteRepo, remoteRepoDir, opts)
+		err := repo.Sync(context.Background())
+		require.ErrorIs(t, err, ErrUntrusted)
+
+		hash, err := repo.GetCurrentCommitHash()
+		require.NoError(t, err)
+		require.Equal(t, trusted, hash)
+	}
+}
+
+func TestVerifyOpenPGPSignedCommit(t *testing.T) {
+	tmpDir := setupTest(t)
+	entity, err := openpgp.NewEntity("Release", "", "release@example.com", nil)
+	require.NoError(t, err)
+
+	var armored strings.Builder
+	w, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+
+	remoteRepoDir := filepath.Join(tmpDir, "remote-repo")
+	remoteRepo, _ := createTestRepo(t, remoteRepoDir)
+	signed := commitSigned(t, remoteRepo, remoteRepoDir, git.CommitOptions{SignKey: entity})
+
+	verifier, err := NewVerifier([]string{writeKey(t, armored.String())})
+	require.NoError(t, err)
+
+	repoPath := filepath.Join(tmpDir, "test-repo")
+	repo := New("test-repo", remoteRepoDir, "", "", repoPath)
+	repo.Verifier = verifier
+	require.NoError(t, repo.Sync(context.Background()))
+
+	hash, err := repo.GetCurrentCommitHash()
+	require.NoError(t, err)
+	require.Equal(t, signed, hash)
+}
+
+func TestVerifySignedTag(t *testing.T) {
+	tmpDir := setupTest(t)
+	signer := newSSHSigner(t)
+	entity, err := openpgp.NewEntity("Release", "", "release@example.com", nil)
+	require.NoError(t, err)
+
+	var armored strings.Builder
+	w, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+
+	// The commit is unsigned, but the tag naming it is signed.
+	remoteRepoDir := filepath.Join(tmpDir, "remote-repo")
+	remoteRepo, commit := createTestRepo(t, remoteRepoDir)
+	head, err := remoteRepo.Head()
+	require.NoError(t, err)
+	_, err = remoteRepo.CreateTag("v1.0.0", head.Hash(), &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "Test User", Email: "test@example.com", When: time.Now()},
+		Message: "release",
+		SignKey: entity,
+	})
+	require.NoError(t, err)
+
+	verifier, err := NewVerifier([]string{
+		writeKey(t, string(ssh.MarshalAuthorizedKey(signer.signer.PublicKey()))),
+		writeKey(t, armored.String()),
+	})
+	require.NoError(t, err)
+
+	repoPath := filepath.Join(tmpDir, "test-repo")
+	repo := New("test-repo", remoteRepoDir, "v1.0.0", "", repoPath)
+	repo.Verifier = verifier
+	require.NoError(t, repo.Sync(context.Background()))
+
+	hash, err := repo.GetCurrentCommitHash()
+	require.NoError(t, err)
+	require.Equal(t, commit, hash)
+
+	// The branch itself points at the unsigned commit.
+	repo = New("test-repo", remoteRepoDir, "master", "", repoPath)
+	repo.Verifier = verifier
+	require.ErrorIs(t, repo.Sync(context.Background()), ErrUntrusted)
+}
+
+func TestNewVerifierRequiresKeys(t *testing.T) {
+	_, err := NewVerifier([]string{writeKey(t, "# no keys\n")})
+	require.ErrorContains(t, err, "no keys found")
+
+	_, err = NewVerifier([]string{writeKey(t, "not a key\n")})
+	require.Error(t, err)
+}
@@ -3,9 +3,13 @@ package podman
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/exec"
+	"strings"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
@@ -28,92 +32,206 @@ func remoteDigest(ctx context.Context, image string) (string, error) {
 	return desc.Digest.String(), nil
 }
 
+// IsPinned reports whether image references a digest rather than only a
+// tag.
+func IsPinned(image string) bool {
+	return strings.Contains(image, "@")
+}
+
+// PinDigest returns image pinned to digest, replacing any tag, for example
+// "nginx:1.27" and "sha256:abc" become "nginx@sha256:abc". Images that are
+// already pinned, and empty digests, are returned unchanged.
+func PinDigest(image, digest string) string {
+	if digest == "" || IsPinned(image) {
+		return image
+	}
+	repo := image
+	// A colon after the last slash separates the tag; earlier colons
+	// belong to a registry port.
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		repo = image[:i]
+	}
+	return repo + "@" + digest
+}
+
 // PullResult reports which images were pulled and their new digests.
 type PullResult struct {
 	// UpdatedDigests maps image references to their new remote digests
 	// after a successful pull.
 	UpdatedDigests map[string]string
+	// Pulled maps every image that was pulled to its remote digest, which
+	// is empty if it could not be determined.
+	Pulled map[string]string
+}
+
+// OutdatedImages returns the subset of images that PullImages would pull:
+// those whose remote digest differs from the stored one, and those whose
+// remote digest cannot be determined. Nothing is pulled. It returns an
+// error if ctx is cancelled before all images were checked.
+func OutdatedImages(ctx context.Context, images []string, knownDigests map[string]string) ([]string, error) {
+	var outdated []string
+	for _, image := range images {
+		remoteDig, err := remoteDigest(ctx, image)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil || knownDigests[image] != remoteDig {
+			outdated = append(outdated, image)
+		}
+	}
+	return outdated, nil
 }
 
 // PullImages pulls the given container images using podman, skipping
 // images whose stored digest already matches the remote registry.
 // The knownDigests map provides previously-stored remote digests keyed
-// by image reference.
-func PullImages(images []string, knownDigests map[string]string, verbose bool) (*PullResult, error) {
-	result := &PullResult{UpdatedDigests: make(map[string]string)}
+// by image reference. Cancelling ctx kills a pull in progress and returns
+// an error together with the images pulled so far.
+func PullImages(ctx context.Context, images []string, knownDigests map[string]string) (*PullResult, error) {
+	result := &PullResult{
+		UpdatedDigests: make(map[string]string),
+		Pulled:         make(map[string]string),
+	}
 
 	if len(images) == 0 {
 		return result, nil
 	}
 
-	ctx := context.Background()
 	total := len(images)
 
-	if verbose {
-		fmt.Printf("Checking %d image(s) for updates...\n", total)
-	}
+	slog.Info("checking images for updates", "count", total)
 
 	var pulled int
-	for i, image := range images {
-		if verbose {
-			fmt.Printf("  [%d/%d] Checking %s\n", i+1, total, image)
-		}
-
+	for _, image := range images {
 		remoteDig, err := remoteDigest(ctx, image)
 		if err != nil {
-			if verbose {
-				fmt.Printf("    Could not check remote digest, pulling to be safe: %v\n", err)
-			}
+			slog.Debug("could not check remote digest, pulling to be safe", "image", image, "error", err)
 		} else if knownDigests[image] == remoteDig {
-			if verbose {
-				fmt.Printf("    Up to date (%s)\n", remoteDig)
-			}
+			slog.Debug("image up to date", "image", image, "digest", remoteDig)
 			continue
-		} else if verbose {
-			local := knownDigests[image]
-			if local == "" {
-				fmt.Printf("    No stored digest, pull required\n")
-			} else {
-				fmt.Printf("    Digest changed (local=%s, remote=%s)\n", local, remoteDig)
-			}
+		} else {
+			slog.Debug("image digest changed", "image", image, "stored", knownDigests[image], "remote", remoteDig)
 		}
 
-		if verbose {
-			fmt.Printf("  [%d/%d] Pulling %s\n", i+1, total, image)
-		}
+		slog.Info("pulling image", "image", image)
 
-		cmd := exec.Command("podman", "pull", image) //nolint:gosec // image names from validated compose files
-		if verbose {
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-			if err := cmd.Run(); err != nil {
-				return result, fmt.Errorf("failed to pull image %s: %w", image, err)
-			}
-		} else {
-			output, err := cmd.CombinedOutput()
-			if err != nil {
-				return result, fmt.Errorf("failed to pull image %s: %w\n%s", image, err, string(output))
-			}
+		cmd := exec.CommandContext(ctx, "podman", "pull", image) //nolint:gosec // image names from validated compose files
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return result, fmt.Errorf("failed to pull image %s: %w\n%s", image, err, string(output))
 		}
 		pulled++
+		result.Pulled[image] = remoteDig
 
 		// Record the digest after a successful pull. If we couldn't
 		// fetch the remote digest earlier, try again now.
 		if remoteDig == "" {
 			remoteDig, err = remoteDigest(ctx, image)
 			if err != nil {
-				if verbose {
-					fmt.Printf("    WARNING: could not determine digest after pull: %v\n", err)
-				}
+				slog.Warn("could not determine digest after pull", "image", image, "error", err)
 				continue
 			}
 		}
+		result.Pulled[image] = remoteDig
 		result.UpdatedDigests[image] = remoteDig
 	}
 
-	if verbose {
-		fmt.Printf("Pulled %d of %d image(s) (%d already up to date)\n", pulled, total, total-pulled)
-	}
+	slog.Info("pulled images", "pulled", pulled, "total", total, "up_to_date", total-pulled)
 
 	return result, nil
 }
+
+// VolumeHasData reports whether the named volume contains any files.
+// Volumes without a local mountpoint, such as those of other drivers, are
+// assumed to contain data.
+func VolumeHasData(ctx context.Context, name string) (bool, error) {
+	//nolint:gosec // volume names come from generated unit files
+	cmd := exec.CommandContext(ctx, "podman", "volume", "inspect", "--format", "{{.Mountpoint}}", name)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect volume %s: %w\n%s", name, err, string(output))
+	}
+	mountpoint := strings.TrimSpace(string(output))
+	if mountpoint == "" {
+		return true, nil
+	}
+	return hasEntries(mountpoint)
+}
+
+// hasEntries reports whether dir contains anything.
+func hasEntries(dir string) (bool, error) {
+	f, err := os.Open(dir) //nolint:gosec // mountpoint reported by podman
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	names, err := f.Readdirnames(1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	return len(names) > 0, nil
+}
+
+// ExportVolume writes the contents of the named volume to a tar archive
+// at path.
+func ExportVolume(ctx context.Context, name, path string) error {
+	//nolint:gosec // volume names come from generated unit files
+	cmd := exec.CommandContext(ctx, "podman", "volume", "export", "--output", path, name)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to export volume %s: %w\n%s", name, err, string(output))
+	}
+	return nil
+}
+
+// RemoveVolume removes the named volume. It fails if a container still
+// uses it.
+func RemoveVolume(ctx context.Context, name string) error {
+	//nolint:gosec // volume names come from generated unit files
+	cmd := exec.CommandContext(ctx, "podman", "volume", "rm", name)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove volume %s: %w\n%s", name, err, string(output))
+	}
+	return nil
+}
+
+// RemoveNetwork removes the named network. It fails if a container still
+// uses it.
+func RemoveNetwork(ctx context.Context, name string) error {
+	//nolint:gosec // network names come from generated unit files
+	cmd := exec.CommandContext(ctx, "podman", "network", "rm", name)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove network %s: %w\n%s", name, err, string(output))
+	}
+	return nil
+}
+
+// systemdUnitLabel is the label podman sets on containers started by a
+// systemd unit, including those generated by Quadlet.
+const systemdUnitLabel = "PODMAN_SYSTEMD_UNIT"
+
+// UnhealthyServices returns the systemd units whose containers currently
+// fail their health check. Containers without a health check, or whose
+// check is still starting, are not reported.
+func UnhealthyServices(ctx context.Context) ([]string, error) {
+	//nolint:gosec // fixed arguments
+	cmd := exec.CommandContext(ctx, "podman", "ps", "--all",
+		"--filter", "health=unhealthy",
+		"--format", `{{ index .Labels "`+systemdUnitLabel+`" }}`)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unhealthy containers: %w", err)
+	}
+	return parseUnitList(string(output)), nil
+}
+
+// parseUnitList returns the non-empty lines of podman ps output.
+func parseUnitList(output string) []string {
+	var units []string
+	for line := range strings.Lines(output) {
+		if unit := strings.TrimSpace(line); unit != "" && unit != "<no value>" {
+			units = append(units, unit)
+		}
+	}
+	return units
+}
@@ -2,23 +2,35 @@ package podman
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPullImagesEmptySlice(t *testing.T) {
-	result, err := PullImages(nil, nil, false)
+	result, err := PullImages(context.Background(), nil, nil)
 	assert.NoError(t, err)
 	assert.Empty(t, result.UpdatedDigests)
 }
 
 func TestPullImagesEmptyList(t *testing.T) {
-	result, err := PullImages([]string{}, nil, false)
+	result, err := PullImages(context.Background(), []string{}, nil)
 	assert.NoError(t, err)
 	assert.Empty(t, result.UpdatedDigests)
 }
 
+func TestPullImagesCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := PullImages(ctx, []string{"docker.io/library/alpine:latest"}, nil)
+	assert.Error(t, err, "cancelled context should stop the pull")
+	assert.Empty(t, result.Pulled)
+}
+
 func TestRemoteDigestInvalidReference(t *testing.T) {
 	_, err := remoteDigest(context.Background(), "://invalid")
 	assert.Error(t, err, "invalid image reference should return an error")
@@ -31,3 +43,67 @@ func TestRemoteDigestCancelledContext(t *testing.T) {
 	_, err := remoteDigest(ctx, "docker.io/library/alpine:latest")
 	assert.Error(t, err, "cancelled context should return an error")
 }
+
+func TestOutdatedImagesEmptyList(t *testing.T) {
+	outdated, err := OutdatedImages(context.Background(), nil, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, outdated)
+}
+
+func TestOutdatedImagesUnresolvableReference(t *testing.T) {
+	outdated, err := OutdatedImages(context.Background(), []string{"://invalid"}, map[string]string{"://invalid": "sha256:abc"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"://invalid"}, outdated, "images whose digest cannot be checked would be pulled")
+}
+
+func TestOutdatedImagesCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := OutdatedImages(ctx, []string{"docker.io/library/alpine:latest"}, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestParseUnitList(t *testing.T) {
+	output := "app-web.service\n\n<no value>\napp-api.service\n"
+	assert.Equal(t, []string{"app-web.service", "app-api.service"}, parseUnitList(output))
+}
+
+func TestPinDigest(t *testing.T) {
+	const digest = "sha256:0123456789abcdef"
+	tests := []struct {
+		image, digest, want string
+	}{
+		{"nginx", digest, "nginx@" + digest},
+		{"nginx:1.27", digest, "nginx@" + digest},
+		{"docker.io/library/nginx:latest", digest, "docker.io/library/nginx@" + digest},
+		{"registry.local:5000/app", digest, "registry.local:5000/app@" + digest},
+		{"registry.local:5000/app:v2", digest, "registry.local:5000/app@" + digest},
+		{"nginx@sha256:fedcba", digest, "nginx@sha256:fedcba"},
+		{"nginx:1.27", "", "nginx:1.27"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, PinDigest(tt.image, tt.digest), tt.image)
+	}
+}
+
+func TestHasEntries(t *testing.T) {
+	dir := t.TempDir()
+	has, err := hasEntries(dir)
+	require.NoError(t, err)
+	assert.False(t, has)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data"), []byte("x"), 0o644))
+	has, err = hasEntries(dir)
+	require.NoError(t, err)
+	assert.True(t, has)
+
+	_, err = hasEntries(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestIsPinned(t *testing.T) {
+	assert.True(t, IsPinned("nginx@sha256:0123456789abcdef"))
+	assert.True(t, IsPinned(PinDigest("registry.local:5000/app:v2", "sha256:0123456789abcdef")))
+	assert.False(t, IsPinned("registry.local:5000/app:v2"))
+}
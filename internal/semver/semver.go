@@ -0,0 +1,66 @@
+// Package semver resolves "semver:" repository references against tag
+// names. It only depends on the semantic version library so that both the
+// git and webhook packages can use it.
+package semver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// Prefix marks a repository reference that tracks the highest tag
+// satisfying a semantic version constraint, for example "semver:~1.4" or
+// "semver:>=2.0.0 <3.0.0". Tags may carry a leading "v". Pre-releases are
+// only selected when the constraint includes one.
+const Prefix = "semver:"
+
+// Matches reports whether tag satisfies the constraint of ref, which must
+// start with Prefix. It returns false for any other ref, an invalid
+// constraint, or a tag that is not a semantic version.
+func Matches(ref, tag string) bool {
+	constraint, ok := strings.CutPrefix(ref, Prefix)
+	if !ok {
+		return false
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return false
+	}
+	v, err := parseTag(tag)
+	return err == nil && c.Check(v)
+}
+
+// Highest returns the highest of tags that satisfies constraint, given
+// without Prefix. Tags that are not semantic versions are ignored. When
+// several tags name the same version, such as "v1.4.2" and "1.4.2", the
+// one that sorts first wins so the result does not depend on tag order.
+func Highest(constraint string, tags []string) (string, error) {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return "", fmt.Errorf("invalid semver constraint %q: %w", constraint, err)
+	}
+
+	var best *semver.Version
+	var bestTag string
+	for _, tag := range tags {
+		v, err := parseTag(tag)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if best == nil || v.GreaterThan(best) || (v.Equal(best) && tag < bestTag) {
+			best, bestTag = v, tag
+		}
+	}
+	if best == nil {
+		return "", fmt.Errorf("no tag satisfies semver constraint %q", constraint)
+	}
+	return bestTag, nil
+}
+
+// parseTag parses a tag as a full semantic version with an optional
+// leading "v". Partial versions such as "v1" or "1.4" are rejected.
+func parseTag(tag string) (*semver.Version, error) {
+	return semver.StrictNewVersion(strings.TrimPrefix(tag, "v"))
+}
@@ -0,0 +1,49 @@
+package semver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatches(t *testing.T) {
+	assert.True(t, Matches("semver:~1.4", "v1.4.7"))
+	assert.True(t, Matches("semver:~1.4", "1.4.7"))
+	assert.False(t, Matches("semver:~1.4", "v1.5.0"))
+	assert.False(t, Matches("semver:~1.4", "v1.4.8-rc.1"))
+	assert.False(t, Matches("v1.4.7", "v1.4.7"))
+	assert.False(t, Matches("semver:~1.4", "latest"))
+	assert.False(t, Matches("semver:~1.4", "v1.4"), "partial versions are not tags of a release")
+	assert.False(t, Matches("semver:~1.4", "release-1.4.7"))
+}
+
+func TestHighest(t *testing.T) {
+	tags := []string{"v1.3.9", "v1.4.0", "v1.4.2", "1.4.10-rc.1", "v1.5", "v2.0.0", "latest"}
+
+	tag, err := Highest("~1.4", tags)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.4.2", tag)
+
+	tag, err = Highest(">=1.0.0", tags)
+	require.NoError(t, err)
+	assert.Equal(t, "v2.0.0", tag)
+
+	_, err = Highest("^3", tags)
+	assert.ErrorContains(t, err, `no tag satisfies semver constraint "^3"`)
+
+	_, err = Highest("not a version", tags)
+	assert.ErrorContains(t, err, "invalid semver constraint")
+}
+
+func TestHighestBreaksTiesByName(t *testing.T) {
+	for _, tags := range [][]string{
+		{"v1.4.2", "1.4.2", "v1.4.1"},
+		{"1.4.2", "v1.4.2", "v1.4.1"},
+		{"v1.4.2+build.2", "v1.4.2", "1.4.2+build.1", "1.4.2"},
+	} {
+		tag, err := Highest("~1.4", tags)
+		require.NoError(t, err)
+		assert.Equal(t, "1.4.2", tag, "tags %v", tags)
+	}
+}
@@ -0,0 +1,127 @@
+package state
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxGenerations is the number of generations kept per repository. The
+// oldest generations are dropped once the limit is exceeded.
+const MaxGenerations = 10
+
+// minCommitPrefix is the shortest commit prefix FindGeneration accepts.
+const minCommitPrefix = 4
+
+// Generation records a single deployment of a repository.
+type Generation struct {
+	ID           int               `json:"id"`
+	Commit       string            `json:"commit"`
+	DeployedAt   time.Time         `json:"deployed_at"`
+	Units        []string          `json:"units,omitempty"`
+	ImageDigests map[string]string `json:"image_digests,omitempty"`
+	// Failed is set when the generation was automatically rolled back
+	// because its services became unhealthy.
+	Failed bool `json:"failed,omitempty"`
+}
+
+// ActiveGeneration returns the currently deployed generation.
+// The second return value is false if the repository has none.
+func (rs RepoState) ActiveGeneration() (Generation, bool) {
+	if i := rs.index(rs.Active); i >= 0 {
+		return rs.Generations[i], true
+	}
+	return Generation{}, false
+}
+
+// PreviousGeneration returns the generation a one-step rollback restores:
+// the nearest generation older than the active one that deployed a
+// different commit. The second return value is false if there is none.
+func (rs RepoState) PreviousGeneration() (Generation, bool) {
+	active := rs.index(rs.Active)
+	if active < 0 {
+		return Generation{}, false
+	}
+	for i := active - 1; i >= 0; i-- {
+		if rs.Generations[i].Commit != rs.Generations[active].Commit {
+			return rs.Generations[i], true
+		}
+	}
+	return Generation{}, false
+}
+
+// FindGeneration resolves ref to a generation. ref is either a generation
+// ID or a commit hash prefix of at least four characters; when several
+// generations deployed the same commit the most recent one is returned.
+func (rs RepoState) FindGeneration(ref string) (Generation, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		if i := rs.index(id); i >= 0 {
+			return rs.Generations[i], nil
+		}
+		// Fall through: an all-digit string may also be a commit prefix.
+	}
+
+	if len(ref) < minCommitPrefix {
+		return Generation{}, fmt.Errorf("no generation %q", ref)
+	}
+
+	var match *Generation
+	for i := len(rs.Generations) - 1; i >= 0; i-- {
+		g := &rs.Generations[i]
+		if !strings.HasPrefix(g.Commit, ref) {
+			continue
+		}
+		if match != nil && match.Commit != g.Commit {
+			return Generation{}, fmt.Errorf("commit prefix %q is ambiguous", ref)
+		}
+		if match == nil {
+			match = g
+		}
+	}
+	if match == nil {
+		return Generation{}, fmt.Errorf("no generation %q", ref)
+	}
+	return *match, nil
+}
+
+// IsFailedCommit reports whether a generation that deployed commit was
+// rolled back because its services became unhealthy.
+func (rs RepoState) IsFailedCommit(commit string) bool {
+	for _, g := range rs.Generations {
+		if g.Commit == commit && g.Failed {
+			return true
+		}
+	}
+	return false
+}
+
+// index returns the position of the generation with the given ID, or -1.
+func (rs RepoState) index(id int) int {
+	for i, g := range rs.Generations {
+		if g.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// record activates a new generation for commit unless it is already the
+// active commit, then trims the history to MaxGenerations.
+func (rs *RepoState) record(commit string, at time.Time) {
+	if g, ok := rs.ActiveGeneration(); ok && g.Commit == commit {
+		return
+	}
+
+	next := 1
+	if n := len(rs.Generations); n > 0 {
+		next = rs.Generations[n-1].ID + 1
+	}
+	rs.Generations = append(rs.Generations, Generation{ID: next, Commit: commit, DeployedAt: at})
+	rs.Active = next
+
+	if n := len(rs.Generations); n > MaxGenerations {
+		rs.Generations = slices.Clone(rs.Generations[n-MaxGenerations:])
+	}
+}
@@ -0,0 +1,89 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// ErrLocked is returned by Lock when another process holds the state lock
+// and the caller chose not to wait.
+var ErrLocked = errors.New("state is locked by another quad-ops process")
+
+// lockPollInterval is how often Lock retries while waiting for the lock.
+const lockPollInterval = 200 * time.Millisecond
+
+// FileLock is an exclusive advisory lock guarding a state file. It is held
+// for the lifetime of the process's open file descriptor, so it is released
+// automatically if the process exits without calling Unlock.
+type FileLock struct {
+	f *os.File
+}
+
+// LockPath returns the path of the lock file for the given state file.
+func LockPath(statePath string) string {
+	return statePath + ".lock"
+}
+
+// Lock acquires an exclusive lock on the lock file beside statePath,
+// creating parent directories as needed. If wait is false and the lock is
+// held elsewhere, it returns ErrLocked immediately; otherwise it retries
+// until the lock is acquired or ctx is done.
+func Lock(ctx context.Context, statePath string, wait bool) (*FileLock, error) {
+	path := LockPath(statePath)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	for {
+		err := flock(f, syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return &FileLock{f: f}, nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if !wait {
+			_ = f.Close()
+			return nil, fmt.Errorf("%w (%s)", ErrLocked, path)
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, fmt.Errorf("gave up waiting for %s: %w", path, ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// flock calls flock(2) on f, retrying if a signal interrupts it, so an
+// interruption is not mistaken for the lock being held elsewhere.
+func flock(f *os.File, how int) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+}
+
+// Unlock releases the lock. The lock file itself is left in place so that
+// concurrent waiters keep contending on the same inode.
+func (l *FileLock) Unlock() error {
+	if err := flock(l.f, syscall.LOCK_UN); err != nil {
+		_ = l.f.Close()
+		return fmt.Errorf("failed to unlock state: %w", err)
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,95 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SchemaVersion is the state file layout written by Save.
+const SchemaVersion = 2
+
+// errNewerSchema is returned when a state file was written by a newer
+// quad-ops than this one.
+var errNewerSchema = errors.New("state file was written by a newer version of quad-ops")
+
+// migrations[i] upgrades a state document from schema version i+1 to i+2.
+// State files written before schema_version existed are version 1.
+var migrations = []func(doc map[string]json.RawMessage) error{
+	migrateGenerations,
+}
+
+// migrate upgrades the state document in data to SchemaVersion.
+func migrate(data []byte) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	version := 1
+	if raw, ok := doc["schema_version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, fmt.Errorf("invalid schema_version: %w", err)
+		}
+		version = max(version, 1)
+	}
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("%w: schema version %d, supported up to %d", errNewerSchema, version, SchemaVersion)
+	}
+	if version == SchemaVersion {
+		return data, nil
+	}
+
+	for v := version; v < SchemaVersion; v++ {
+		if err := migrations[v-1](doc); err != nil {
+			return nil, fmt.Errorf("failed to migrate from schema version %d: %w", v, err)
+		}
+	}
+	doc["schema_version"] = json.RawMessage(strconv.Itoa(SchemaVersion))
+	return json.Marshal(doc)
+}
+
+// migrateGenerations converts the version 1 layout, which tracked only the
+// current and previous commit of each repository, into generations. The
+// managed units belong to the generation of the current commit.
+func migrateGenerations(doc map[string]json.RawMessage) error {
+	var repos map[string]struct {
+		RepoState
+		Current  string `json:"current"`
+		Previous string `json:"previous"`
+	}
+	if raw, ok := doc["repositories"]; ok {
+		if err := json.Unmarshal(raw, &repos); err != nil {
+			return err
+		}
+	}
+	var managedUnits map[string][]string
+	if raw, ok := doc["managed_units"]; ok {
+		if err := json.Unmarshal(raw, &managedUnits); err != nil {
+			return err
+		}
+	}
+
+	converted := make(map[string]RepoState, len(repos))
+	for name, r := range repos {
+		rs := r.RepoState
+		// Some unversioned files already use generations.
+		if len(rs.Generations) == 0 && r.Current != "" {
+			if r.Previous != "" {
+				rs.record(r.Previous, time.Time{})
+			}
+			rs.record(r.Current, time.Time{})
+			rs.Generations[len(rs.Generations)-1].Units = managedUnits[name]
+		}
+		converted[name] = rs
+	}
+
+	raw, err := json.Marshal(converted)
+	if err != nil {
+		return err
+	}
+	doc["repositories"] = raw
+	return nil
+}
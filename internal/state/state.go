@@ -1,20 +1,30 @@
-// Package state manages deployment state for quad-ops, tracking
-// current and previous commit hashes per repository to enable rollback,
-// and content hashes per unit for change detection.
+// Package state manages deployment state for quad-ops, tracking a bounded
+// history of deployed generations per repository to enable rollback, and
+// content hashes per unit for change detection.
 package state
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
+	"time"
 )
 
-// RepoState tracks the deployed commit hashes for a single repository.
+// RepoState tracks the deployment history of a single repository.
 type RepoState struct {
-	Current  string `json:"current"`
-	Previous string `json:"previous,omitempty"`
+	// Active is the ID of the generation currently deployed.
+	Active int `json:"active"`
+	// Generations lists recorded deployments, oldest first.
+	Generations []Generation `json:"generations,omitempty"`
+	// OnRemove is the onRemove policy the repository was last synced with,
+	// applied to its units once it is no longer configured.
+	OnRemove string `json:"on_remove,omitempty"`
 }
 
 // UnitState tracks content hashes for change detection of a single unit.
@@ -24,28 +34,63 @@ type UnitState struct {
 }
 
 // State holds the deployment state for all repositories.
+// Its methods are safe for concurrent use; direct access to the exported
+// maps is not, and must not overlap with concurrent method calls.
 type State struct {
-	Repositories map[string]RepoState `json:"repositories"`
-	ManagedUnits map[string][]string  `json:"managed_units,omitempty"`
-	UnitStates   map[string]UnitState `json:"unit_states,omitempty"`
-	ImageDigests map[string]string    `json:"image_digests,omitempty"`
+	SchemaVersion int                  `json:"schema_version"`
+	Repositories  map[string]RepoState `json:"repositories"`
+	ManagedUnits  map[string][]string  `json:"managed_units,omitempty"`
+	UnitStates    map[string]UnitState `json:"unit_states,omitempty"`
+	ImageDigests  map[string]string    `json:"image_digests,omitempty"`
+
+	mu sync.RWMutex
 }
 
-// Load reads the state file from disk. Returns an empty state if the file does not exist.
+// Load reads the state file from disk, migrating older layouts to
+// SchemaVersion. Returns an empty state if the file does not exist. If the
+// file is corrupt, the backup kept by Save is loaded instead.
 func Load(path string) (*State, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return &State{
-				Repositories: make(map[string]RepoState),
-				ManagedUnits: make(map[string][]string),
-				UnitStates:   make(map[string]UnitState),
-				ImageDigests: make(map[string]string),
+				SchemaVersion: SchemaVersion,
+				Repositories:  make(map[string]RepoState),
+				ManagedUnits:  make(map[string][]string),
+				UnitStates:    make(map[string]UnitState),
+				ImageDigests:  make(map[string]string),
 			}, nil
 		}
 		return nil, fmt.Errorf("failed to read state file: %w", err)
 	}
 
+	s, err := Parse(data)
+	if err == nil {
+		return s, nil
+	}
+	if errors.Is(err, errNewerSchema) {
+		return nil, err
+	}
+
+	if backup, bakErr := os.ReadFile(BackupPath(path)); bakErr == nil {
+		if s, bakErr := Parse(backup); bakErr == nil {
+			slog.Warn("state file is corrupt, using backup", "path", path, "backup", BackupPath(path), "error", err)
+			return s, nil
+		}
+	}
+	return nil, err
+}
+
+// Parse decodes a state document, migrating older layouts to SchemaVersion.
+func Parse(data []byte) (*State, error) {
+	data, err := migrate(data)
+	if err != nil {
+		if errors.Is(err, errNewerSchema) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+
 	s := &State{}
 	if err := json.Unmarshal(data, s); err != nil {
 		return nil, fmt.Errorf("failed to parse state file: %w", err)
@@ -70,56 +115,250 @@ func Load(path string) (*State, error) {
 	return s, nil
 }
 
+// BackupPath returns the path of the backup Save keeps of the previous
+// state file.
+func BackupPath(statePath string) string {
+	return statePath + ".bak"
+}
+
 // Save writes the state to disk, creating parent directories as needed.
+// The file is replaced atomically, so a crash leaves either the old or the
+// new state in place, and the previous state is kept at BackupPath.
 func (s *State) Save(path string) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return fmt.Errorf("failed to create state directory: %w", err)
 	}
 
+	s.mu.Lock()
+	s.SchemaVersion = SchemaVersion
 	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0o644); err != nil {
+	// A corrupt file is not worth keeping and must not replace a good
+	// backup.
+	if old, err := os.ReadFile(path); err == nil && json.Valid(old) {
+		if err := writeFileAtomic(BackupPath(path), old); err != nil {
+			return fmt.Errorf("failed to back up state file: %w", err)
+		}
+	}
+
+	if err := writeFileAtomic(path, data); err != nil {
 		return fmt.Errorf("failed to write state file: %w", err)
 	}
 
 	return nil
 }
 
-// SetCommit records a new deployment for the named repository,
-// shifting the current commit to previous.
+// writeFileAtomic writes data to a temporary file beside path, flushes it
+// to disk, and renames it over path.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer func() { _ = os.Remove(tmp) }()
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Close() }()
+	return d.Sync()
+}
+
+// SetCommit records a deployment of commitHash for the named repository.
+// If it differs from the active generation's commit a new generation is
+// appended and activated; otherwise the active generation is kept.
 func (s *State) SetCommit(repoName, commitHash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Repositories == nil {
+		s.Repositories = make(map[string]RepoState)
+	}
+	rs := s.Repositories[repoName]
+	rs.record(commitHash, time.Now().UTC())
+	s.Repositories[repoName] = rs
+}
+
+// ActivateGeneration makes an existing generation of the named repository
+// the active one, as done by a rollback. No new generation is recorded, so
+// repeated rollbacks keep moving further back in history.
+func (s *State) ActivateGeneration(repoName string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	rs := s.Repositories[repoName]
-	if rs.Current != commitHash {
-		rs.Previous = rs.Current
-		rs.Current = commitHash
+	if rs.index(id) < 0 {
+		return fmt.Errorf("repository %s has no generation %d", repoName, id)
 	}
+	rs.Active = id
 	s.Repositories[repoName] = rs
+	return nil
+}
+
+// MarkGenerationFailed flags a generation of the named repository as having
+// failed its post-deploy health check.
+func (s *State) MarkGenerationFailed(repoName string, id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rs := s.Repositories[repoName]
+	if i := rs.index(id); i >= 0 {
+		rs.Generations[i].Failed = true
+	}
 }
 
-// GetPrevious returns the previous commit hash for the named repository.
-// Returns empty string if no previous state exists.
+// GetRepo returns a copy of the deployment history of the named repository.
+func (s *State) GetRepo(repoName string) RepoState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rs := s.Repositories[repoName]
+	rs.Generations = slices.Clone(rs.Generations)
+	return rs
+}
+
+// SetOnRemove records the onRemove policy of the named repository. It does
+// nothing for a repository that has never been deployed.
+func (s *State) SetOnRemove(repoName, policy string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs, ok := s.Repositories[repoName]
+	if !ok {
+		return
+	}
+	rs.OnRemove = policy
+	s.Repositories[repoName] = rs
+}
+
+// GetOnRemove returns the onRemove policy recorded for the named repository,
+// or an empty string if none was recorded.
+func (s *State) GetOnRemove(repoName string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Repositories[repoName].OnRemove
+}
+
+// GetCurrent returns the commit hash of the active generation for the named
+// repository. Returns empty string if the repository has not been deployed.
+func (s *State) GetCurrent(repoName string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, _ := s.Repositories[repoName].ActiveGeneration()
+	return g.Commit
+}
+
+// GetPrevious returns the commit hash of the generation a rollback of the
+// named repository would restore. Returns empty string if there is none.
 func (s *State) GetPrevious(repoName string) string {
-	return s.Repositories[repoName].Previous
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, _ := s.Repositories[repoName].PreviousGeneration()
+	return g.Commit
+}
+
+// SetGenerationImageDigests records the image digests deployed by the
+// active generation of the named repository. Digests already recorded for
+// an image are kept: they are what the generation first ran with, and later
+// syncs of the same commit may have pulled newer images for moving tags.
+func (s *State) SetGenerationImageDigests(repoName string, digests map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rs, ok := s.Repositories[repoName]
+	if !ok {
+		return
+	}
+	i := rs.index(rs.Active)
+	if i < 0 {
+		return
+	}
+	g := &rs.Generations[i]
+	for image, digest := range digests {
+		if _, ok := g.ImageDigests[image]; ok {
+			continue
+		}
+		if g.ImageDigests == nil {
+			g.ImageDigests = make(map[string]string)
+		}
+		g.ImageDigests[image] = digest
+	}
 }
 
 // SetManagedUnits records the quadlet unit filenames managed for a repository.
 func (s *State) SetManagedUnits(repoName string, units []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setManagedUnits(repoName, units)
+}
+
+func (s *State) setManagedUnits(repoName string, units []string) {
 	if s.ManagedUnits == nil {
 		s.ManagedUnits = make(map[string][]string)
 	}
 	s.ManagedUnits[repoName] = units
+
+	// Keep the active generation's unit list in step so that history
+	// records what each generation deployed.
+	if rs, ok := s.Repositories[repoName]; ok && units != nil {
+		if i := rs.index(rs.Active); i >= 0 {
+			rs.Generations[i].Units = units
+		}
+	}
+}
+
+// RetainUnits adds units to the repository's managed units without
+// recording them on its active generation, so that units the repository no
+// longer defines but were not removed are still considered by later syncs.
+func (s *State) RetainUnits(repoName string, units ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ManagedUnits == nil {
+		s.ManagedUnits = make(map[string][]string)
+	}
+	for _, u := range units {
+		if !slices.Contains(s.ManagedUnits[repoName], u) {
+			// Copy so the active generation's unit list is not modified.
+			s.ManagedUnits[repoName] = append(slices.Clip(s.ManagedUnits[repoName]), u)
+		}
+	}
 }
 
 // GetManagedUnits returns the quadlet unit filenames managed for a repository.
 func (s *State) GetManagedUnits(repoName string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.ManagedUnits[repoName]
 }
 
 // SetUnitState records content hashes for a unit.
 func (s *State) SetUnitState(unitName string, us UnitState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.UnitStates == nil {
 		s.UnitStates = make(map[string]UnitState)
 	}
@@ -129,17 +368,23 @@ func (s *State) SetUnitState(unitName string, us UnitState) {
 // GetUnitState returns the stored content hashes for a unit.
 // The second return value is false if no state exists for the unit.
 func (s *State) GetUnitState(unitName string) (UnitState, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	us, ok := s.UnitStates[unitName]
 	return us, ok
 }
 
 // RemoveUnitState removes stored content hashes for a unit.
 func (s *State) RemoveUnitState(unitName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	delete(s.UnitStates, unitName)
 }
 
 // CollectAllManagedUnits returns a set of all unit filenames across all repositories.
 func (s *State) CollectAllManagedUnits() map[string]struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	result := make(map[string]struct{})
 	for _, units := range s.ManagedUnits {
 		for _, u := range units {
@@ -149,14 +394,85 @@ func (s *State) CollectAllManagedUnits() map[string]struct{} {
 	return result
 }
 
+// UnitOwners returns a map from each managed unit filename to the name of
+// the repository that manages it.
+func (s *State) UnitOwners() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make(map[string]string)
+	for repoName, units := range s.ManagedUnits {
+		for _, u := range units {
+			result[u] = repoName
+		}
+	}
+	return result
+}
+
+// CollectManagedUnitsFor returns a set of the unit filenames managed by the
+// named repositories only.
+func (s *State) CollectManagedUnitsFor(repoNames []string) map[string]struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make(map[string]struct{})
+	for _, name := range repoNames {
+		for _, u := range s.ManagedUnits[name] {
+			result[u] = struct{}{}
+		}
+	}
+	return result
+}
+
 // PruneRemovedRepos clears managed units for repositories no longer present
-// in the provided set of configured repository names.
-func (s *State) PruneRemovedRepos(configuredRepos map[string]struct{}) {
+// in the provided set of configured repository names. If only is non-empty,
+// repositories outside it are left untouched.
+func (s *State) PruneRemovedRepos(configuredRepos map[string]struct{}, only ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	for repoName := range s.ManagedUnits {
+		if len(only) > 0 && !slices.Contains(only, repoName) {
+			continue
+		}
 		if _, ok := configuredRepos[repoName]; !ok {
-			s.SetManagedUnits(repoName, nil)
+			s.setManagedUnits(repoName, nil)
+		}
+	}
+}
+
+// ForgetRepo removes the deployment history and managed units of the named
+// repository, and the stored states of those units. Unit files on disk are
+// not touched. It reports whether the repository was recorded.
+func (s *State) ForgetRepo(repoName string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, hasHistory := s.Repositories[repoName]
+	units, hasUnits := s.ManagedUnits[repoName]
+	for _, u := range units {
+		delete(s.UnitStates, u)
+	}
+	delete(s.Repositories, repoName)
+	delete(s.ManagedUnits, repoName)
+	return hasHistory || hasUnits
+}
+
+// ForgetUnit removes unit from the managed units of every repository and
+// drops its stored state. Unit files on disk are not touched. It reports
+// whether the unit was recorded.
+func (s *State) ForgetUnit(unit string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, found := s.UnitStates[unit]
+	delete(s.UnitStates, unit)
+	for repoName, units := range s.ManagedUnits {
+		if !slices.Contains(units, unit) {
+			continue
 		}
+		found = true
+		// The slice may be shared with the active generation.
+		s.setManagedUnits(repoName, slices.DeleteFunc(slices.Clone(units), func(u string) bool { return u == unit }))
 	}
+	return found
 }
 
 // DiffUnits returns unit names present in oldUnits but not in newUnits.
@@ -174,6 +490,8 @@ func DiffUnits(oldUnits, newUnits map[string]struct{}) []string {
 // unit names that previously existed with different content or bind mount hashes.
 // New units (not previously tracked) are excluded — they only need start, not restart.
 func (s *State) ChangedUnits(newStates map[string]UnitState) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	var changed []string
 	for name, newUnitState := range newStates {
 		oldUnitState, exists := s.UnitStates[name]
@@ -193,11 +511,15 @@ func (s *State) ChangedUnits(newStates map[string]UnitState) []string {
 
 // GetImageDigest returns the stored remote digest for an image.
 func (s *State) GetImageDigest(image string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.ImageDigests[image]
 }
 
 // SetImageDigest records the remote digest for an image after a successful pull.
 func (s *State) SetImageDigest(image, digest string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.ImageDigests == nil {
 		s.ImageDigests = make(map[string]string)
 	}
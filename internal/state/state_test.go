@@ -1,9 +1,13 @@
 package state
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -27,24 +31,25 @@ func TestSaveAndLoad(t *testing.T) {
 
 	loaded, err := Load(path)
 	require.NoError(t, err)
-	assert.Equal(t, "abc123", loaded.Repositories["my-repo"].Current)
-	assert.Empty(t, loaded.Repositories["my-repo"].Previous)
+	assert.Equal(t, "abc123", loaded.GetCurrent("my-repo"))
+	assert.Empty(t, loaded.GetPrevious("my-repo"))
 }
 
 func TestSetCommitShiftsPrevious(t *testing.T) {
 	s := &State{Repositories: make(map[string]RepoState)}
 
 	s.SetCommit("repo", "first")
-	assert.Equal(t, "first", s.Repositories["repo"].Current)
-	assert.Empty(t, s.Repositories["repo"].Previous)
+	assert.Equal(t, "first", s.GetCurrent("repo"))
+	assert.Empty(t, s.GetPrevious("repo"))
 
 	s.SetCommit("repo", "second")
-	assert.Equal(t, "second", s.Repositories["repo"].Current)
-	assert.Equal(t, "first", s.Repositories["repo"].Previous)
+	assert.Equal(t, "second", s.GetCurrent("repo"))
+	assert.Equal(t, "first", s.GetPrevious("repo"))
 
 	s.SetCommit("repo", "third")
-	assert.Equal(t, "third", s.Repositories["repo"].Current)
-	assert.Equal(t, "second", s.Repositories["repo"].Previous)
+	assert.Equal(t, "third", s.GetCurrent("repo"))
+	assert.Equal(t, "second", s.GetPrevious("repo"))
+	assert.Equal(t, 3, s.Repositories["repo"].Active)
 }
 
 func TestSetCommitIdempotent(t *testing.T) {
@@ -52,8 +57,208 @@ func TestSetCommitIdempotent(t *testing.T) {
 
 	s.SetCommit("repo", "abc")
 	s.SetCommit("repo", "abc")
-	assert.Equal(t, "abc", s.Repositories["repo"].Current)
-	assert.Empty(t, s.Repositories["repo"].Previous)
+	assert.Equal(t, "abc", s.GetCurrent("repo"))
+	assert.Empty(t, s.GetPrevious("repo"))
+	assert.Len(t, s.Repositories["repo"].Generations, 1)
+}
+
+func TestRollbackWalksBackThroughGenerations(t *testing.T) {
+	s := &State{Repositories: make(map[string]RepoState)}
+	for _, commit := range []string{"first", "second", "third"} {
+		s.SetCommit("repo", commit)
+	}
+
+	prev, ok := s.GetRepo("repo").PreviousGeneration()
+	require.True(t, ok)
+	require.NoError(t, s.ActivateGeneration("repo", prev.ID))
+	assert.Equal(t, "second", s.GetCurrent("repo"))
+
+	// A second rollback keeps going back instead of returning to "third".
+	prev, ok = s.GetRepo("repo").PreviousGeneration()
+	require.True(t, ok)
+	require.NoError(t, s.ActivateGeneration("repo", prev.ID))
+	assert.Equal(t, "first", s.GetCurrent("repo"))
+
+	_, ok = s.GetRepo("repo").PreviousGeneration()
+	assert.False(t, ok)
+	assert.Error(t, s.ActivateGeneration("repo", 42))
+}
+
+func TestPreviousGenerationSkipsSameCommit(t *testing.T) {
+	s := &State{Repositories: make(map[string]RepoState)}
+	s.SetCommit("repo", "good")
+	s.SetCommit("repo", "bad")
+	require.NoError(t, s.ActivateGeneration("repo", 1))
+	// Redeploying the bad commit records a new generation.
+	s.SetCommit("repo", "bad")
+
+	assert.Len(t, s.Repositories["repo"].Generations, 3)
+	assert.Equal(t, "good", s.GetPrevious("repo"))
+}
+
+func TestSetCommitTrimsHistory(t *testing.T) {
+	s := &State{Repositories: make(map[string]RepoState)}
+	for i := range MaxGenerations + 5 {
+		s.SetCommit("repo", fmt.Sprintf("commit-%d", i))
+	}
+
+	rs := s.GetRepo("repo")
+	assert.Len(t, rs.Generations, MaxGenerations)
+	assert.Equal(t, 6, rs.Generations[0].ID)
+	assert.Equal(t, MaxGenerations+5, rs.Active)
+}
+
+func TestMarkGenerationFailed(t *testing.T) {
+	s := &State{Repositories: make(map[string]RepoState)}
+	s.SetCommit("repo", "good")
+	s.SetCommit("repo", "bad")
+	s.MarkGenerationFailed("repo", 2)
+	s.MarkGenerationFailed("missing", 1)
+
+	rs := s.GetRepo("repo")
+	assert.True(t, rs.IsFailedCommit("bad"))
+	assert.False(t, rs.IsFailedCommit("good"))
+}
+
+func TestFindGeneration(t *testing.T) {
+	rs := RepoState{Active: 3, Generations: []Generation{
+		{ID: 1, Commit: "aaaa1111"},
+		{ID: 2, Commit: "bbbb2222"},
+		{ID: 3, Commit: "aaaa3333"},
+	}}
+
+	g, err := rs.FindGeneration("2")
+	require.NoError(t, err)
+	assert.Equal(t, "bbbb2222", g.Commit)
+
+	g, err = rs.FindGeneration("bbbb")
+	require.NoError(t, err)
+	assert.Equal(t, 2, g.ID)
+
+	_, err = rs.FindGeneration("aaaa")
+	assert.ErrorContains(t, err, "ambiguous")
+
+	_, err = rs.FindGeneration("abc")
+	assert.ErrorContains(t, err, "no generation")
+
+	_, err = rs.FindGeneration("9")
+	assert.ErrorContains(t, err, "no generation")
+}
+
+func TestManagedUnitsRecordedOnActiveGeneration(t *testing.T) {
+	s := &State{Repositories: make(map[string]RepoState)}
+	s.SetCommit("repo", "first")
+	s.SetManagedUnits("repo", []string{"a.container"})
+	s.SetCommit("repo", "second")
+	s.SetManagedUnits("repo", []string{"b.container"})
+	s.SetGenerationImageDigests("repo", map[string]string{"nginx:latest": "sha256:abc"})
+
+	rs := s.GetRepo("repo")
+	assert.Equal(t, []string{"a.container"}, rs.Generations[0].Units)
+	assert.Equal(t, []string{"b.container"}, rs.Generations[1].Units)
+	assert.Nil(t, rs.Generations[0].ImageDigests)
+	assert.Equal(t, "sha256:abc", rs.Generations[1].ImageDigests["nginx:latest"])
+
+	// A later sync of the same commit keeps the digests first recorded.
+	s.SetGenerationImageDigests("repo", map[string]string{"nginx:latest": "sha256:def", "redis:7": "sha256:123"})
+	rs = s.GetRepo("repo")
+	assert.Equal(t, "sha256:abc", rs.Generations[1].ImageDigests["nginx:latest"])
+	assert.Equal(t, "sha256:123", rs.Generations[1].ImageDigests["redis:7"])
+}
+
+func TestLoadLegacyCommitPair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	legacy := `{"repositories":{"r":{"current":"new","previous":"old"}},"managed_units":{"r":["r-web.container"]}}`
+	require.NoError(t, os.WriteFile(path, []byte(legacy), 0o644))
+
+	s, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "new", s.GetCurrent("r"))
+	assert.Equal(t, "old", s.GetPrevious("r"))
+
+	active, ok := s.GetRepo("r").ActiveGeneration()
+	require.True(t, ok)
+	assert.Equal(t, []string{"r-web.container"}, active.Units)
+}
+
+func TestLoadUnversionedGenerations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	doc := `{"repositories":{"r":{"active":2,"generations":[{"id":1,"commit":"a"},{"id":2,"commit":"b","units":["r-web.container"]}]}}}`
+	require.NoError(t, os.WriteFile(path, []byte(doc), 0o644))
+
+	s, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, SchemaVersion, s.SchemaVersion)
+	assert.Equal(t, "b", s.GetCurrent("r"))
+	assert.Equal(t, "a", s.GetPrevious("r"))
+	assert.Len(t, s.GetRepo("r").Generations, 2)
+}
+
+func TestLoadNewerSchemaVersion(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	doc := fmt.Sprintf(`{"schema_version":%d,"repositories":{}}`, SchemaVersion+1)
+	require.NoError(t, os.WriteFile(path, []byte(doc), 0o644))
+	require.NoError(t, os.WriteFile(BackupPath(path), []byte(`{"repositories":{}}`), 0o644))
+
+	_, err := Load(path)
+	assert.ErrorIs(t, err, errNewerSchema)
+}
+
+func TestSaveWritesSchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s := &State{Repositories: make(map[string]RepoState)}
+	require.NoError(t, s.Save(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), fmt.Sprintf(`"schema_version": %d`, SchemaVersion))
+}
+
+func TestSaveKeepsBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	s := &State{Repositories: make(map[string]RepoState)}
+	s.SetCommit("r", "first")
+	require.NoError(t, s.Save(path))
+	_, err := os.Stat(BackupPath(path))
+	assert.True(t, os.IsNotExist(err), "first save has nothing to back up")
+
+	s.SetCommit("r", "second")
+	require.NoError(t, s.Save(path))
+
+	backup, err := Load(BackupPath(path))
+	require.NoError(t, err)
+	assert.Equal(t, "first", backup.GetCurrent("r"))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "temporary files should not be left behind")
+}
+
+func TestLoadCorruptFileUsesBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	s := &State{Repositories: make(map[string]RepoState)}
+	s.SetCommit("r", "good")
+	s.SetManagedUnits("r", []string{"r-web.container"})
+	require.NoError(t, s.Save(path))
+	require.NoError(t, s.Save(path))
+
+	// Simulate a truncated write.
+	require.NoError(t, os.WriteFile(path, []byte(`{"repositories":{"r":`), 0o644))
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "good", loaded.GetCurrent("r"))
+	assert.Equal(t, []string{"r-web.container"}, loaded.GetManagedUnits("r"))
+
+	// Saving over the corrupt file must not replace the good backup.
+	require.NoError(t, loaded.Save(path))
+	backup, err := Load(BackupPath(path))
+	require.NoError(t, err)
+	assert.Equal(t, "good", backup.GetCurrent("r"))
 }
 
 func TestGetPreviousMissingRepo(t *testing.T) {
@@ -61,6 +266,23 @@ func TestGetPreviousMissingRepo(t *testing.T) {
 	assert.Empty(t, s.GetPrevious("nonexistent"))
 }
 
+func TestSetOnRemove(t *testing.T) {
+	s := &State{Repositories: make(map[string]RepoState)}
+
+	s.SetOnRemove("undeployed", "keep")
+	assert.NotContains(t, s.Repositories, "undeployed", "a never-deployed repo should not be recorded")
+
+	s.SetCommit("my-repo", "abc123")
+	s.SetOnRemove("my-repo", "keep")
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, s.Save(path))
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "keep", loaded.GetOnRemove("my-repo"))
+	assert.Empty(t, loaded.GetOnRemove("other"))
+}
+
 func TestLoadCorruptFile(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "state.json")
@@ -334,6 +556,76 @@ func TestCollectAllManagedUnitsEmpty(t *testing.T) {
 	assert.Empty(t, result)
 }
 
+func TestCollectManagedUnitsFor(t *testing.T) {
+	s := &State{
+		Repositories: make(map[string]RepoState),
+		ManagedUnits: map[string][]string{
+			"repo-a": {"a-web.container", "a-net.network"},
+			"repo-b": {"b-api.container"},
+		},
+	}
+
+	result := s.CollectManagedUnitsFor([]string{"repo-a", "missing"})
+	assert.Len(t, result, 2)
+	assert.Contains(t, result, "a-web.container")
+	assert.Contains(t, result, "a-net.network")
+	assert.NotContains(t, result, "b-api.container")
+}
+
+func TestUnitOwners(t *testing.T) {
+	s := &State{
+		ManagedUnits: map[string][]string{
+			"repo-a": {"a-web.container", "a-net.network"},
+			"repo-b": {"b-api.container"},
+		},
+	}
+
+	assert.Equal(t, map[string]string{
+		"a-web.container": "repo-a",
+		"a-net.network":   "repo-a",
+		"b-api.container": "repo-b",
+	}, s.UnitOwners())
+}
+
+func TestForgetRepo(t *testing.T) {
+	s := &State{Repositories: make(map[string]RepoState)}
+	s.SetCommit("a", "abc")
+	s.SetManagedUnits("a", []string{"a-web.container"})
+	s.SetUnitState("a-web.container", UnitState{ContentHash: "h1"})
+	s.SetCommit("b", "def")
+	s.SetManagedUnits("b", []string{"b-web.container"})
+	s.SetUnitState("b-web.container", UnitState{ContentHash: "h2"})
+
+	assert.True(t, s.ForgetRepo("a"))
+	assert.Empty(t, s.GetCurrent("a"))
+	assert.NotContains(t, s.ManagedUnits, "a")
+	_, ok := s.GetUnitState("a-web.container")
+	assert.False(t, ok)
+
+	assert.Equal(t, "def", s.GetCurrent("b"))
+	_, ok = s.GetUnitState("b-web.container")
+	assert.True(t, ok)
+
+	assert.False(t, s.ForgetRepo("a"))
+}
+
+func TestForgetUnit(t *testing.T) {
+	s := &State{Repositories: make(map[string]RepoState)}
+	s.SetCommit("a", "abc")
+	s.SetManagedUnits("a", []string{"a-web.container", "a-db.container"})
+	s.SetUnitState("a-web.container", UnitState{ContentHash: "h1"})
+
+	assert.True(t, s.ForgetUnit("a-web.container"))
+	assert.Equal(t, []string{"a-db.container"}, s.GetManagedUnits("a"))
+	active, ok := s.GetRepo("a").ActiveGeneration()
+	require.True(t, ok)
+	assert.Equal(t, []string{"a-db.container"}, active.Units)
+	_, ok = s.GetUnitState("a-web.container")
+	assert.False(t, ok)
+
+	assert.False(t, s.ForgetUnit("a-web.container"))
+}
+
 func TestDiffUnits(t *testing.T) {
 	old := map[string]struct{}{
 		"app-web.container": {},
@@ -390,6 +682,22 @@ func TestPruneRemovedRepos(t *testing.T) {
 	assert.Equal(t, []string{"c-db.container"}, s.GetManagedUnits("repo-c"))
 }
 
+func TestPruneRemovedReposScoped(t *testing.T) {
+	s := &State{
+		Repositories: make(map[string]RepoState),
+		ManagedUnits: map[string][]string{
+			"repo-a": {"a-web.container"},
+			"repo-b": {"b-api.container"},
+		},
+	}
+
+	// Neither repo is configured, but only repo-a is in scope
+	s.PruneRemovedRepos(map[string]struct{}{}, "repo-a")
+
+	assert.Nil(t, s.GetManagedUnits("repo-a"))
+	assert.Equal(t, []string{"b-api.container"}, s.GetManagedUnits("repo-b"))
+}
+
 func TestSetAndGetImageDigest(t *testing.T) {
 	s := &State{
 		Repositories: make(map[string]RepoState),
@@ -452,3 +760,82 @@ func TestSetUnitStateInitializesNilMap(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, "hash", got.ContentHash)
 }
+
+func TestConcurrentUpdates(t *testing.T) {
+	s := &State{
+		Repositories: make(map[string]RepoState),
+		ManagedUnits: make(map[string][]string),
+	}
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("repo-%d", i)
+			s.SetCommit(name, "abc")
+			s.SetManagedUnits(name, []string{name + ".container"})
+			_ = s.CollectAllManagedUnits()
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, s.Repositories, 50)
+	assert.Len(t, s.CollectAllManagedUnits(), 50)
+}
+
+func TestLockFailsFastWhenHeld(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "state.json")
+
+	held, err := Lock(context.Background(), path, false)
+	require.NoError(t, err)
+	assert.FileExists(t, LockPath(path))
+
+	_, err = Lock(context.Background(), path, false)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	require.NoError(t, held.Unlock())
+
+	again, err := Lock(context.Background(), path, false)
+	require.NoError(t, err)
+	require.NoError(t, again.Unlock())
+}
+
+func TestLockWaitsForRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	held, err := Lock(context.Background(), path, false)
+	require.NoError(t, err)
+
+	acquired := make(chan error, 1)
+	go func() {
+		l, err := Lock(context.Background(), path, true)
+		if err == nil {
+			err = l.Unlock()
+		}
+		acquired <- err
+	}()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("lock acquired while held: %v", err)
+	case <-time.After(2 * lockPollInterval):
+	}
+
+	require.NoError(t, held.Unlock())
+	require.NoError(t, <-acquired)
+}
+
+func TestLockWaitHonorsContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	held, err := Lock(context.Background(), path, false)
+	require.NoError(t, err)
+	defer func() { _ = held.Unlock() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), lockPollInterval)
+	defer cancel()
+
+	_, err = Lock(ctx, path, true)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
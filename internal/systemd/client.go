@@ -42,9 +42,21 @@ type Client interface {
 	DaemonReload(ctx context.Context) error
 	Enable(ctx context.Context, units ...string) error
 	Disable(ctx context.Context, units ...string) error
+	Status(ctx context.Context, units ...string) ([]UnitStatus, error)
+	// Connected reports whether the D-Bus connection is still usable. It
+	// turns false when the bus or systemd restarts.
+	Connected() bool
 	Close() error
 }
 
+// UnitStatus describes the live state of a systemd unit.
+type UnitStatus struct {
+	Name        string
+	LoadState   string
+	ActiveState string
+	SubState    string
+}
+
 // Error represents a systemd operation error with context.
 type Error struct {
 	Op    string
@@ -256,6 +268,32 @@ func (c *client) Disable(ctx context.Context, units ...string) error {
 	return nil
 }
 
+func (c *client) Status(ctx context.Context, units ...string) ([]UnitStatus, error) {
+	if len(units) == 0 {
+		return nil, nil
+	}
+
+	listed, err := c.conn.ListUnitsByNamesContext(ctx, units)
+	if err != nil {
+		return nil, &Error{Op: "status", Scope: c.scope, Err: err}
+	}
+
+	statuses := make([]UnitStatus, 0, len(listed))
+	for _, u := range listed {
+		statuses = append(statuses, UnitStatus{
+			Name:        u.Name,
+			LoadState:   u.LoadState,
+			ActiveState: u.ActiveState,
+			SubState:    u.SubState,
+		})
+	}
+	return statuses, nil
+}
+
+func (c *client) Connected() bool {
+	return c.conn != nil && c.conn.Connected()
+}
+
 func (c *client) Close() error {
 	if c.conn != nil {
 		c.conn.Close()
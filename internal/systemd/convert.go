@@ -3,6 +3,7 @@ package systemd
 import (
 	"fmt"
 	"path/filepath"
+	"strings"
 
 	"github.com/compose-spec/compose-go/v2/types"
 	"gopkg.in/ini.v1"
@@ -45,6 +46,18 @@ func Convert(project *types.Project, repo RepositoryMeta) ([]Unit, error) {
 	return units, nil
 }
 
+// ServiceName returns the systemd service that Quadlet generates for a unit
+// file: "app.container" → "app.service", "data.volume" → "data-volume.service"
+// and "net.network" → "net-network.service".
+func ServiceName(unitFile string) string {
+	ext := filepath.Ext(unitFile)
+	base := strings.TrimSuffix(unitFile, ext)
+	if ext == ".container" {
+		return base + ".service"
+	}
+	return base + "-" + strings.TrimPrefix(ext, ".") + ".service"
+}
+
 // effectiveName returns the Podman resource name to use. If the compose config
 // has an explicit name that differs from compose-go's auto-generated
 // "{project}_{resource}" default, that explicit name takes priority. Otherwise
@@ -144,3 +144,18 @@ func TestConvert_ResolvesRelativeBindMountPaths(t *testing.T) {
 func hasExtension(name, ext string) bool {
 	return len(name) > len(ext) && name[len(name)-len(ext):] == ext
 }
+
+func TestServiceName(t *testing.T) {
+	tests := []struct {
+		unit string
+		want string
+	}{
+		{"app-web.container", "app-web.service"},
+		{"app-data.volume", "app-data-volume.service"},
+		{"app-default.network", "app-default-network.service"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ServiceName(tt.unit))
+	}
+}
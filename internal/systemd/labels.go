@@ -2,6 +2,13 @@ package systemd
 
 import (
 	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/ini.v1"
 
 	"github.com/trly/quad-ops/internal/buildinfo"
 )
@@ -38,3 +45,67 @@ func baseLabels(repo RepositoryMeta) []string {
 func applyBaseLabels(shadows map[string][]string, repo RepositoryMeta) {
 	shadows["Label"] = append(shadows["Label"], baseLabels(repo)...)
 }
+
+// quadletExtensions lists the unit file types quad-ops generates.
+var quadletExtensions = []string{".container", ".volume", ".network"}
+
+// LabeledUnit is a unit file in the quadlet directory that carries the
+// quad-ops labels.
+type LabeledUnit struct {
+	Name string
+	// Repository is the repository named in the unit's labels, or empty
+	// if the label is missing.
+	Repository string
+}
+
+// FindLabeledUnits returns the unit files in quadletDir that carry the
+// quad-ops labels, sorted by name. A missing directory yields no units.
+// Files that cannot be parsed are logged and skipped.
+func FindLabeledUnits(quadletDir string) ([]LabeledUnit, error) {
+	entries, err := os.ReadDir(quadletDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read quadlet directory: %w", err)
+	}
+
+	var units []LabeledUnit
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !slices.Contains(quadletExtensions, filepath.Ext(entry.Name())) {
+			continue
+		}
+
+		file, err := loadUnitFile(filepath.Join(quadletDir, entry.Name()))
+		if err != nil {
+			slog.Warn("skipping unreadable unit file", "unit", entry.Name(), "error", err)
+			continue
+		}
+		if repo, ok := quadOpsRepository(file); ok {
+			units = append(units, LabeledUnit{Name: entry.Name(), Repository: repo})
+		}
+	}
+	return units, nil
+}
+
+// quadOpsRepository reports whether file carries quad-ops labels and
+// returns the repository they name.
+func quadOpsRepository(file *ini.File) (string, bool) {
+	var labeled bool
+	for _, section := range file.Sections() {
+		key, err := section.GetKey("Label")
+		if err != nil {
+			continue
+		}
+		for _, label := range key.ValueWithShadows() {
+			if !strings.HasPrefix(label, labelPrefix+".") {
+				continue
+			}
+			labeled = true
+			if repo, ok := strings.CutPrefix(label, labelPrefix+".repository.name="); ok {
+				return repo, true
+			}
+		}
+	}
+	return "", labeled
+}
@@ -2,10 +2,13 @@ package systemd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/trly/quad-ops/internal/buildinfo"
 )
 
@@ -101,3 +104,74 @@ func TestBuildNetwork_BaseLabelsApplied(t *testing.T) {
 	assert.Contains(t, vals, "com.github.trly.quad-ops.repository.name=infra")
 	assert.Contains(t, vals, "com.github.trly.quad-ops.repository.url=https://github.com/org/infra")
 }
+
+func TestFindLabeledUnits(t *testing.T) {
+	dir := t.TempDir()
+
+	project := &types.Project{
+		Name: "app",
+		Services: types.Services{
+			"web": {Name: "web", Image: "nginx:latest"},
+		},
+		Volumes: types.Volumes{
+			"data": {Name: "data"},
+		},
+	}
+	units, err := Convert(project, RepositoryMeta{Name: "infra", URL: "https://example.com/infra.git"})
+	require.NoError(t, err)
+	require.NoError(t, WriteUnits(units, dir))
+
+	unlabeled := "[Container]\nImage=alpine\nLabel=other.label=value\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "manual.container"), []byte(unlabeled), 0o644))
+	nameless := "[Network]\nLabel=com.github.trly.quad-ops.version=dev\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nameless.network"), []byte(nameless), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("Label=com.github.trly.quad-ops.repository.name=x"), 0o644))
+	// Hand-written files that do not parse are skipped.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.container"), []byte("[Container\nImage=alpine\n"), 0o644))
+
+	found, err := FindLabeledUnits(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []LabeledUnit{
+		{Name: "app-data.volume", Repository: "infra"},
+		{Name: "app-web.container", Repository: "infra"},
+		{Name: "nameless.network"},
+	}, found)
+}
+
+func TestFindLabeledUnitsMissingDir(t *testing.T) {
+	found, err := FindLabeledUnits(filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func TestResourceName(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	tests := []struct {
+		path       string
+		kind, name string
+	}{
+		{write("app-data.volume", "[Volume]\nVolumeName=app-data\n"), "volume", "app-data"},
+		{write("app-cache.volume", "[Volume]\nDriver=local\n"), "volume", "systemd-app-cache"},
+		{write("app-default.network", "[Network]\nNetworkName = app-default\n"), "network", "app-default"},
+		{write("app-web.container", "[Container]\nImage=nginx\n"), "", ""},
+	}
+	for _, tt := range tests {
+		kind, name, err := ResourceName(tt.path)
+		require.NoError(t, err)
+		assert.Equal(t, tt.kind, kind, tt.path)
+		assert.Equal(t, tt.name, name, tt.path)
+
+		file, err := loadUnitFile(tt.path)
+		require.NoError(t, err)
+		unit := Unit{Name: filepath.Base(tt.path), File: file}
+		kind, name = unit.ResourceName()
+		assert.Equal(t, tt.kind, kind, "in-memory %s", tt.path)
+		assert.Equal(t, tt.name, name, "in-memory %s", tt.path)
+	}
+}
@@ -0,0 +1,66 @@
+package systemd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// loadUnitFile parses an existing unit file.
+func loadUnitFile(path string) (*ini.File, error) {
+	file, err := ini.LoadSources(ini.LoadOptions{AllowShadows: true, KeyValueDelimiters: "="}, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse unit file %s: %w", filepath.Base(path), err)
+	}
+	return file, nil
+}
+
+// ResourceName returns the kind ("volume" or "network") and name of the
+// Podman resource that the .volume or .network unit file at path creates.
+// Quadlet names the resource "systemd-<unit>" unless VolumeName or
+// NetworkName is set. Other unit types return an empty kind.
+func ResourceName(path string) (kind, name string, err error) {
+	if kind, _, _ := resourceKey(path); kind == "" {
+		return "", "", nil
+	}
+
+	file, err := loadUnitFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	kind, name = resourceName(filepath.Base(path), file)
+	return kind, name, nil
+}
+
+// ResourceName returns the kind and name of the Podman resource that the
+// unit creates, like the package-level ResourceName does for unit files.
+func (u *Unit) ResourceName() (kind, name string) {
+	return resourceName(u.Name, u.File)
+}
+
+// resourceName resolves the resource created by the named unit from its
+// parsed contents.
+func resourceName(unit string, file *ini.File) (kind, name string) {
+	kind, section, key := resourceKey(unit)
+	if kind == "" {
+		return "", ""
+	}
+	if name := file.Section(section).Key(key).String(); name != "" {
+		return kind, name
+	}
+	return kind, "systemd-" + strings.TrimSuffix(unit, filepath.Ext(unit))
+}
+
+// resourceKey returns the resource kind of a unit and the section and key
+// that override its resource name.
+func resourceKey(unit string) (kind, section, key string) {
+	switch filepath.Ext(unit) {
+	case ".volume":
+		return "volume", "Volume", "VolumeName"
+	case ".network":
+		return "network", "Network", "NetworkName"
+	}
+	return "", "", ""
+}
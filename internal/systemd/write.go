@@ -1,34 +1,255 @@
 package systemd
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+// stagingPrefix starts the names of the temporary files WriteUnits creates
+// in the quadlet directory. They have no unit extension, so Quadlet ignores
+// them.
+const stagingPrefix = ".quad-ops-staging-"
+
+// stagedUnit is a unit rendered to a temporary file in the quadlet directory.
+type stagedUnit struct {
+	name string
+	tmp  string
+	// backup is a hard link to the file being replaced, or "" if the unit
+	// is new.
+	backup string
+}
+
 // WriteUnits writes each unit to a separate file in the quadlet directory.
+// All units are first rendered into temporary files in quadletDir, which
+// keeps them on the same filesystem, and only moved into place, each with
+// an atomic rename, once every unit has been written and synced. A
+// rendering failure therefore leaves the quadlet directory untouched, and a
+// crash can never leave a truncated unit file behind for Quadlet to parse.
+// If a rename fails, the units already moved are restored to their previous
+// content.
 func WriteUnits(units []Unit, quadletDir string) error {
 	if err := os.MkdirAll(quadletDir, 0o755); err != nil {
 		return fmt.Errorf("failed to create quadlet directory: %w", err)
 	}
 
+	if len(units) == 0 {
+		return nil
+	}
+
+	var staged []stagedUnit
+	defer func() {
+		for _, su := range staged {
+			_ = os.Remove(su.tmp)
+			if su.backup != "" {
+				_ = os.Remove(su.backup)
+			}
+		}
+	}()
+
+	seen := make(map[string]struct{}, len(units))
 	for _, unit := range units {
-		filename := filepath.Join(quadletDir, unit.Name)
+		if _, ok := seen[unit.Name]; ok {
+			continue
+		}
+		seen[unit.Name] = struct{}{}
 
-		f, err := os.Create(filename)
+		tmp, err := stageUnit(unit, quadletDir)
 		if err != nil {
-			return fmt.Errorf("failed to create unit file %s: %w", filename, err)
+			return err
 		}
+		staged = append(staged, stagedUnit{name: unit.Name, tmp: tmp})
+	}
 
-		if err := unit.WriteUnit(f); err != nil {
-			_ = f.Close()
-			return fmt.Errorf("failed to write unit file %s: %w", filename, err)
+	// Keep the current files reachable so they can be put back if moving
+	// the new ones into place fails.
+	for i := range staged {
+		dst := filepath.Join(quadletDir, staged[i].name)
+		backup := staged[i].tmp + ".orig"
+		if err := os.Link(dst, backup); err == nil {
+			staged[i].backup = backup
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to back up unit file %s: %w", dst, err)
 		}
+	}
+
+	if err := syncDir(quadletDir); err != nil {
+		return err
+	}
+
+	for i, su := range staged {
+		dst := filepath.Join(quadletDir, su.name)
+		if err := os.Rename(su.tmp, dst); err != nil {
+			err = fmt.Errorf("failed to move unit file %s into place: %w", dst, err)
+			return errors.Join(err, restoreUnits(staged[:i], quadletDir))
+		}
+	}
+
+	return syncDir(quadletDir)
+}
+
+// restoreUnits puts back the files that the staged units replaced and
+// removes the units that were new. It returns an error naming the units
+// that could not be restored.
+func restoreUnits(moved []stagedUnit, quadletDir string) error {
+	var failed []string
+	for _, su := range moved {
+		dst := filepath.Join(quadletDir, su.name)
+		var err error
+		if su.backup != "" {
+			err = os.Rename(su.backup, dst)
+		} else {
+			err = os.Remove(dst)
+		}
+		if err != nil {
+			failed = append(failed, su.name)
+		}
+	}
+	_ = syncDir(quadletDir)
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to restore unit files, they contain the new version: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// RemoveStaging deletes temporary files that an interrupted WriteUnits left
+// in quadletDir. It must not run concurrently with WriteUnits.
+func RemoveStaging(quadletDir string) error {
+	leftovers, err := filepath.Glob(filepath.Join(quadletDir, stagingPrefix+"*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range leftovers {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove staging file: %w", err)
+		}
+	}
+	return nil
+}
+
+// stageUnit renders unit into a temporary file in dir, flushes it to disk,
+// and returns its path.
+func stageUnit(unit Unit, dir string) (string, error) {
+	return stageFile(dir, unit.Name, unit.WriteUnit)
+}
+
+// stageFile writes the content produced by write for the unit file name to
+// a temporary file in dir, flushes it to disk, and returns its path.
+func stageFile(dir, name string, write func(io.Writer) error) (string, error) {
+	f, err := os.CreateTemp(dir, stagingPrefix+"*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create unit file %s: %w", name, err)
+	}
+	filename := f.Name()
+	fail := func(format string, err error) (string, error) {
+		_ = f.Close()
+		_ = os.Remove(filename)
+		return "", fmt.Errorf(format, name, err)
+	}
+
+	if err := f.Chmod(0o644); err != nil {
+		return fail("failed to set permissions of unit file %s: %w", err)
+	}
+
+	if err := write(f); err != nil {
+		return fail("failed to write unit file %s: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return fail("failed to sync unit file %s: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		_ = os.Remove(filename)
+		return "", fmt.Errorf("failed to close unit file %s: %w", name, err)
+	}
+
+	return filename, nil
+}
+
+// RemoveInstallSection rewrites the unit file name in quadletDir without
+// its [Install] section, so Quadlet no longer enables the generated service
+// and it stays stopped across reboots. The rest of the file is kept as is.
+// It reports whether the file had an [Install] section.
+func RemoveInstallSection(quadletDir, name string) (bool, error) {
+	path := filepath.Join(quadletDir, name)
+	data, err := os.ReadFile(path) //nolint:gosec // unit file in the configured quadlet directory
+	if err != nil {
+		return false, fmt.Errorf("failed to read unit file %s: %w", name, err)
+	}
 
-		if err := f.Close(); err != nil {
-			return fmt.Errorf("failed to close unit file %s: %w", filename, err)
+	var kept strings.Builder
+	var inInstall, found bool
+	for line := range strings.Lines(string(data)) {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			inInstall = trimmed == "[Install]"
+			found = found || inInstall
 		}
+		if !inInstall {
+			kept.WriteString(line)
+		}
+	}
+	if !found {
+		return false, nil
 	}
 
+	tmp, err := stageFile(quadletDir, name, func(w io.Writer) error {
+		_, err := io.WriteString(w, kept.String())
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return false, fmt.Errorf("failed to move unit file %s into place: %w", path, err)
+	}
+	return true, syncDir(quadletDir)
+}
+
+// syncDir flushes directory entries so that renames survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory %s: %w", dir, err)
+	}
+	defer func() { _ = d.Close() }()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
 	return nil
 }
+
+// CompareUnits renders each unit in memory and compares it against the file
+// of the same name in the quadlet directory without modifying anything.
+// It returns the names of units that do not exist on disk yet and of units
+// whose rendered content differs from the existing file.
+func CompareUnits(units []Unit, quadletDir string) (added, changed []string, err error) {
+	for _, unit := range units {
+		var buf bytes.Buffer
+		if err := unit.WriteUnit(&buf); err != nil {
+			return nil, nil, fmt.Errorf("failed to render unit %s: %w", unit.Name, err)
+		}
+
+		filename := filepath.Join(quadletDir, unit.Name)
+		existing, err := os.ReadFile(filename)
+		if err != nil {
+			if os.IsNotExist(err) {
+				added = append(added, unit.Name)
+				continue
+			}
+			return nil, nil, fmt.Errorf("failed to read unit file %s: %w", filename, err)
+		}
+
+		if !bytes.Equal(existing, buf.Bytes()) {
+			changed = append(changed, unit.Name)
+		}
+	}
+
+	return added, changed, nil
+}
@@ -63,6 +63,86 @@ func TestWriteUnitsEmptySlice(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestWriteUnitsIsAllOrNothing(t *testing.T) {
+	parent := t.TempDir()
+	quadletDir := filepath.Join(parent, "systemd")
+	require.NoError(t, os.MkdirAll(quadletDir, 0o755))
+
+	existing := filepath.Join(quadletDir, "app.container")
+	require.NoError(t, os.WriteFile(existing, []byte("[Container]\nImage=alpine:3.19\n"), 0o644))
+
+	units := []Unit{
+		{Name: "app.container", File: testIniFile("Container", map[string]string{"Image": "alpine:3.20"})},
+		{Name: "new.container", File: testIniFile("Container", map[string]string{"Image": "alpine:3.20"})},
+		// A name that cannot be moved into place forces a failure after
+		// the units before it were renamed.
+		{Name: "missing/bad.container", File: testIniFile("Container", map[string]string{"Image": "alpine:latest"})},
+	}
+
+	err := WriteUnits(units, quadletDir)
+	require.Error(t, err)
+
+	content, err := os.ReadFile(existing)
+	require.NoError(t, err)
+	assert.Equal(t, "[Container]\nImage=alpine:3.19\n", string(content), "replaced unit must be restored")
+	assert.NoFileExists(t, filepath.Join(quadletDir, "new.container"), "added unit must be removed again")
+
+	entries, err := os.ReadDir(quadletDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "staging files should be removed")
+
+	parentEntries, err := os.ReadDir(parent)
+	require.NoError(t, err)
+	assert.Len(t, parentEntries, 1, "nothing should be written beside the quadlet directory")
+}
+
+func TestRemoveStaging(t *testing.T) {
+	quadletDir := t.TempDir()
+	unit := filepath.Join(quadletDir, "app.container")
+	leftover := filepath.Join(quadletDir, stagingPrefix+"123")
+	require.NoError(t, os.WriteFile(unit, nil, 0o644))
+	require.NoError(t, os.WriteFile(leftover, nil, 0o644))
+	require.NoError(t, os.WriteFile(leftover+".orig", nil, 0o644))
+
+	require.NoError(t, RemoveStaging(quadletDir))
+
+	assert.FileExists(t, unit)
+	assert.NoFileExists(t, leftover)
+	assert.NoFileExists(t, leftover+".orig")
+}
+
+func TestWriteUnitsReplacesExisting(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "app.container")
+	require.NoError(t, os.WriteFile(path, []byte("[Container]\nImage=alpine:3.19\nExtra=a much longer line than the replacement\n"), 0o644))
+
+	unit := Unit{Name: "app.container", File: testIniFile("Container", map[string]string{"Image": "alpine:3.20"})}
+	require.NoError(t, WriteUnits([]Unit{unit}, tmpDir))
+
+	_, changed, err := CompareUnits([]Unit{unit}, tmpDir)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+}
+
+func TestRemoveInstallSection(t *testing.T) {
+	quadletDir := t.TempDir()
+	unit := "[Container]\nImage=alpine\nExec=sh -c 'echo # not a comment'\n\n[Install]\nWantedBy=default.target\n\n[Service]\nRestart=always\n"
+	path := filepath.Join(quadletDir, "app.container")
+	require.NoError(t, os.WriteFile(path, []byte(unit), 0o644))
+
+	removed, err := RemoveInstallSection(quadletDir, "app.container")
+	require.NoError(t, err)
+	assert.True(t, removed)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "[Container]\nImage=alpine\nExec=sh -c 'echo # not a comment'\n\n[Service]\nRestart=always\n", string(content))
+
+	removed, err = RemoveInstallSection(quadletDir, "app.container")
+	require.NoError(t, err)
+	assert.False(t, removed)
+}
+
 // testIniFile is a helper to create a test ini.File with a section and keys.
 func testIniFile(sectionName string, keys map[string]string) *ini.File {
 	file := ini.Empty()
@@ -72,3 +152,36 @@ func testIniFile(sectionName string, keys map[string]string) *ini.File {
 	}
 	return file
 }
+
+func TestCompareUnitsDetectsAddedAndChanged(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	same := Unit{Name: "same.container", File: testIniFile("Container", map[string]string{"Image": "alpine:latest"})}
+	changed := Unit{Name: "changed.container", File: testIniFile("Container", map[string]string{"Image": "alpine:3.20"})}
+	added := Unit{Name: "added.volume", File: testIniFile("Volume", map[string]string{"Driver": "local"})}
+
+	require.NoError(t, WriteUnits([]Unit{same}, tmpDir))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, changed.Name), []byte("[Container]\nImage=alpine:3.19\n"), 0o644))
+
+	gotAdded, gotChanged, err := CompareUnits([]Unit{same, changed, added}, tmpDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"added.volume"}, gotAdded)
+	assert.Equal(t, []string{"changed.container"}, gotChanged)
+
+	// Nothing should have been written
+	_, err = os.Stat(filepath.Join(tmpDir, added.Name))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCompareUnitsMissingDirectory(t *testing.T) {
+	tmpDir := filepath.Join(t.TempDir(), "missing")
+
+	units := []Unit{
+		{Name: "test.container", File: testIniFile("Container", map[string]string{"Image": "alpine:latest"})},
+	}
+
+	added, changed, err := CompareUnits(units, tmpDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test.container"}, added)
+	assert.Empty(t, changed)
+}
@@ -0,0 +1,213 @@
+// Package webhook parses and verifies git push webhooks from GitHub, Gitea,
+// and GitLab so a daemon can trigger targeted repository syncs.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/trly/quad-ops/internal/semver"
+)
+
+// Provider identifies the git hosting service that sent a webhook.
+type Provider string
+
+const (
+	ProviderGitHub Provider = "github"
+	ProviderGitea  Provider = "gitea"
+	ProviderGitLab Provider = "gitlab"
+)
+
+var (
+	// ErrUnknownProvider is returned when a request carries no recognized event header.
+	ErrUnknownProvider = errors.New("unrecognized webhook provider")
+	// ErrInvalidSignature is returned when a request's signature or token does not match the secret.
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrIgnoredEvent is returned for well-formed events that are not pushes, such as pings.
+	ErrIgnoredEvent = errors.New("event is not a push")
+)
+
+// PushEvent is the provider-independent subset of a push webhook.
+type PushEvent struct {
+	Provider      Provider
+	Ref           string   // full ref that was pushed, e.g. "refs/heads/main"
+	URLs          []string // clone, SSH, and web URLs of the pushed repository
+	DefaultBranch string   // repository default branch, if reported
+}
+
+// Parse identifies the provider of a webhook request, verifies its
+// signature or token against secret, and decodes push events. body must be
+// the raw, unmodified request body.
+func Parse(header http.Header, body []byte, secret string) (*PushEvent, error) {
+	switch {
+	case header.Get("X-Gitea-Event") != "":
+		// Gitea also sends X-GitHub-Event for compatibility, so check it first.
+		if !validHMAC(secret, body, header.Get("X-Gitea-Signature")) {
+			return nil, ErrInvalidSignature
+		}
+		if header.Get("X-Gitea-Event") != "push" {
+			return nil, ErrIgnoredEvent
+		}
+		return parseGitHubStyle(ProviderGitea, body)
+
+	case header.Get("X-GitHub-Event") != "":
+		sig, ok := strings.CutPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+		if !ok || !validHMAC(secret, body, sig) {
+			return nil, ErrInvalidSignature
+		}
+		if header.Get("X-GitHub-Event") != "push" {
+			return nil, ErrIgnoredEvent
+		}
+		return parseGitHubStyle(ProviderGitHub, body)
+
+	case header.Get("X-Gitlab-Event") != "":
+		token := header.Get("X-Gitlab-Token")
+		if secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			return nil, ErrInvalidSignature
+		}
+		switch header.Get("X-Gitlab-Event") {
+		case "Push Hook", "Tag Push Hook":
+			return parseGitLab(body)
+		default:
+			return nil, ErrIgnoredEvent
+		}
+
+	default:
+		return nil, ErrUnknownProvider
+	}
+}
+
+// validHMAC reports whether signature is the hex-encoded HMAC-SHA256 of body
+// keyed with secret. An empty secret never validates.
+func validHMAC(secret string, body []byte, signature string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// githubPush is the push payload shared by GitHub and Gitea.
+type githubPush struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		CloneURL      string `json:"clone_url"`
+		SSHURL        string `json:"ssh_url"`
+		HTMLURL       string `json:"html_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+func parseGitHubStyle(provider Provider, body []byte) (*PushEvent, error) {
+	var p githubPush
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse %s push payload: %w", provider, err)
+	}
+	return &PushEvent{
+		Provider:      provider,
+		Ref:           p.Ref,
+		URLs:          nonEmpty(p.Repository.CloneURL, p.Repository.SSHURL, p.Repository.HTMLURL),
+		DefaultBranch: p.Repository.DefaultBranch,
+	}, nil
+}
+
+// gitlabPush is the GitLab push and tag push payload.
+type gitlabPush struct {
+	Ref     string `json:"ref"`
+	Project struct {
+		GitHTTPURL    string `json:"git_http_url"`
+		GitSSHURL     string `json:"git_ssh_url"`
+		WebURL        string `json:"web_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"project"`
+}
+
+func parseGitLab(body []byte) (*PushEvent, error) {
+	var p gitlabPush
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse %s push payload: %w", ProviderGitLab, err)
+	}
+	return &PushEvent{
+		Provider:      ProviderGitLab,
+		Ref:           p.Ref,
+		URLs:          nonEmpty(p.Project.GitHTTPURL, p.Project.GitSSHURL, p.Project.WebURL),
+		DefaultBranch: p.Project.DefaultBranch,
+	}, nil
+}
+
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Matches reports whether the push affects a repository configured with the
+// given URL and ref. An empty ref tracks the remote default branch, and a
+// semver ref matches pushed tags that satisfy its constraint. Refs that name
+// a commit never match because they cannot move.
+func (e *PushEvent) Matches(repoURL, ref string) bool {
+	want := NormalizeURL(repoURL)
+	urlMatch := false
+	for _, u := range e.URLs {
+		if NormalizeURL(u) == want {
+			urlMatch = true
+			break
+		}
+	}
+	if !urlMatch {
+		return false
+	}
+
+	if ref == "" {
+		return e.DefaultBranch != "" && e.Ref == "refs/heads/"+e.DefaultBranch
+	}
+	if strings.HasPrefix(ref, semver.Prefix) {
+		tag, ok := strings.CutPrefix(e.Ref, "refs/tags/")
+		return ok && semver.Matches(ref, tag)
+	}
+	if strings.HasPrefix(ref, "refs/") {
+		return e.Ref == ref
+	}
+	return e.Ref == "refs/heads/"+ref || e.Ref == "refs/tags/"+ref
+}
+
+// NormalizeURL reduces a git remote URL to "host/path" so that HTTPS, SSH,
+// and scp-style forms of the same repository compare equal. Credentials,
+// ports, a trailing ".git", and trailing slashes are dropped, and the host
+// is lowercased.
+func NormalizeURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+
+	var host, path string
+	if u, err := url.Parse(raw); err == nil && u.Scheme != "" && u.Host != "" {
+		host, path = u.Hostname(), u.Path
+	} else if at := strings.Index(raw, "@"); at >= 0 && strings.Contains(raw[at:], ":") {
+		// scp-like syntax: user@host:path
+		rest := raw[at+1:]
+		colon := strings.Index(rest, ":")
+		host, path = rest[:colon], rest[colon+1:]
+	} else {
+		return strings.TrimSuffix(strings.TrimSuffix(raw, "/"), ".git")
+	}
+
+	path = strings.Trim(path, "/")
+	path = strings.TrimSuffix(path, ".git")
+	return strings.ToLower(host) + "/" + path
+}